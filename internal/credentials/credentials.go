@@ -0,0 +1,127 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrNotFound is returned when a source has no credential with a given name
+var ErrNotFound = errors.New("credential not found")
+
+// ErrNoKeyring is returned when the system keyring cannot be used
+var ErrNoKeyring = errors.New("no system keyring available, please install 'secret-tool'")
+
+// Source is an interface for stores which credentials can be read from. Each
+// credential is identified by a name such as 'ubuntuone/password'.
+type Source interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// Command reads credentials from the output of an external command, such as
+// 'pass show'. The command is run by the shell, with the name of the credential
+// passed as $1 and in the GHSTAT_CREDENTIAL environment variable.
+type Command struct {
+	Command string
+}
+
+// Get runs the command to read the named credential. A command which fails, or
+// prints nothing, is treated as not having the credential.
+func (c Command) Get(ctx context.Context, name string) (string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.Command, "ghstat", name)
+	cmd.Env = append(os.Environ(), "GHSTAT_CREDENTIAL="+name)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr := (&exec.ExitError{}); errors.As(err, &exitErr) {
+			slog.Debug("credential command failed", "credential", name, "error", err.Error(), "stderr", strings.TrimSpace(stderr.String()))
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("failed to run credential command: %w", err)
+	}
+
+	value := strings.TrimRight(string(out), "\r\n")
+	if len(value) == 0 {
+		return "", ErrNotFound
+	}
+
+	return value, nil
+}
+
+// Keyring reads and writes credentials in the Secret Service keyring, such as
+// GNOME Keyring or KWallet, using the 'secret-tool' command
+type Keyring struct {
+	// Path is the path of the 'secret-tool' binary, which is found in the PATH
+	// if not specified
+	Path string
+}
+
+// keyringService is the value of the 'service' attribute of each credential
+// stored in the keyring by ghstat
+const keyringService = "ghstat"
+
+// Available reports whether the keyring can be used
+func (k Keyring) Available() bool {
+	_, err := exec.LookPath(k.path())
+	return err == nil
+}
+
+// Get looks up the named credential in the keyring
+func (k Keyring) Get(ctx context.Context, name string) (string, error) {
+	if !k.Available() {
+		return "", ErrNoKeyring
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, k.path(), "lookup", "service", keyringService, "credential", name)
+	cmd.Stderr = &stderr
+
+	// secret-tool exits with an error if the credential doesn't exist, which
+	// can't be distinguished from a locked or unavailable keyring
+	out, err := cmd.Output()
+	if err != nil {
+		slog.Debug("keyring lookup failed", "credential", name, "error", err.Error(), "stderr", strings.TrimSpace(stderr.String()))
+		return "", ErrNotFound
+	}
+
+	if len(out) == 0 {
+		return "", ErrNotFound
+	}
+
+	return string(out), nil
+}
+
+// Store saves the named credential in the keyring, replacing any existing value
+func (k Keyring) Store(ctx context.Context, name, value string) error {
+	if !k.Available() {
+		return ErrNoKeyring
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, k.path(), "store", "--label", "ghstat: "+name, "service", keyringService, "credential", name)
+	cmd.Stdin = strings.NewReader(value)
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to store credential in keyring: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// path returns the path of the 'secret-tool' binary
+func (k Keyring) path() string {
+	if len(k.Path) > 0 {
+		return k.Path
+	}
+	return "secret-tool"
+}
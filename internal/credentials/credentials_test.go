@@ -0,0 +1,73 @@
+package credentials_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"jnsgruk/ghstat/internal/credentials"
+	"jnsgruk/ghstat/internal/credentials/credentialstest"
+)
+
+func TestCommand(t *testing.T) {
+	for command, expected := range map[string]string{
+		`echo "secret for $1"`:                     "secret for ubuntuone/password",
+		`printf '%s' "$GHSTAT_CREDENTIAL"`:         "ubuntuone/password",
+		`printf 'with spaces  \n'`:                 "with spaces  ",
+		`[ "$1" = ubuntuone/password ] && echo ok`: "ok",
+	} {
+		value, err := credentials.Command{Command: command}.Get(context.Background(), "ubuntuone/password")
+		if err != nil || value != expected {
+			t.Errorf("incorrect credential from '%s', expected '%s', got '%s' (%v)", command, expected, value, err)
+		}
+	}
+}
+
+func TestCommandNotFound(t *testing.T) {
+	for _, command := range []string{"exit 1", "true", "echo"} {
+		_, err := credentials.Command{Command: command}.Get(context.Background(), "ubuntuone/password")
+		if !errors.Is(err, credentials.ErrNotFound) {
+			t.Errorf("expected credentials.ErrNotFound from '%s', got %v", command, err)
+		}
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	k := credentialstest.NewKeyring(t)
+
+	if !k.Available() {
+		t.Fatalf("expected fake keyring to be available")
+	}
+
+	if _, err := k.Get(context.Background(), "ubuntuone/login"); !errors.Is(err, credentials.ErrNotFound) {
+		t.Errorf("expected credentials.ErrNotFound for a missing credential, got %v", err)
+	}
+
+	for _, value := range []string{"joe@example.com", "joe@example.org"} {
+		if err := k.Store(context.Background(), "ubuntuone/login", value); err != nil {
+			t.Fatalf("failed to store credential: %s", err.Error())
+		}
+
+		got, err := k.Get(context.Background(), "ubuntuone/login")
+		if err != nil || got != value {
+			t.Errorf("incorrect credential from keyring, expected '%s', got '%s' (%v)", value, got, err)
+		}
+	}
+}
+
+func TestKeyringUnavailable(t *testing.T) {
+	k := credentials.Keyring{Path: filepath.Join(t.TempDir(), "secret-tool")}
+
+	if k.Available() {
+		t.Errorf("expected keyring without secret-tool to be unavailable")
+	}
+
+	if _, err := k.Get(context.Background(), "ubuntuone/login"); !errors.Is(err, credentials.ErrNoKeyring) {
+		t.Errorf("expected credentials.ErrNoKeyring, got %v", err)
+	}
+
+	if err := k.Store(context.Background(), "ubuntuone/login", "joe"); !errors.Is(err, credentials.ErrNoKeyring) {
+		t.Errorf("expected credentials.ErrNoKeyring, got %v", err)
+	}
+}
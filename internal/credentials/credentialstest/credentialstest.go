@@ -0,0 +1,53 @@
+// Package credentialstest provides stand-ins for credential sources and
+// prompts, for use in tests
+package credentialstest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"jnsgruk/ghstat/internal/credentials"
+)
+
+// NewKeyring returns a Keyring backed by a stand-in for 'secret-tool', which
+// stores each credential in a file named after its attributes
+func NewKeyring(t testing.TB) credentials.Keyring {
+	t.Helper()
+
+	dir := t.TempDir()
+	script := `#!/bin/sh
+dir="` + dir + `"
+case "$1" in
+lookup) cat "$dir/$(echo "$3-$5" | tr / _)" 2>/dev/null ;;
+store) cat > "$dir/$(echo "$5-$7" | tr / _)" ;;
+*) exit 2 ;;
+esac
+`
+
+	path := filepath.Join(dir, "secret-tool")
+	if err := os.WriteFile(path, []byte(script), 0700); err != nil {
+		t.Fatalf("failed to write fake secret-tool: %s", err.Error())
+	}
+
+	return credentials.Keyring{Path: path}
+}
+
+// Prompter answers prompts with predefined values, recording the labels of
+// the prompts it has been asked
+type Prompter struct {
+	Values map[string]string
+	Asked  []string
+}
+
+// Prompt returns the predefined value for label, or an error if there is none
+func (p *Prompter) Prompt(label string, secret bool) (string, error) {
+	p.Asked = append(p.Asked, label)
+
+	value, ok := p.Values[label]
+	if !ok {
+		return "", fmt.Errorf("unexpected prompt '%s'", label)
+	}
+	return value, nil
+}
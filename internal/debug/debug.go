@@ -0,0 +1,209 @@
+package debug
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ErrNoBundle is returned when no debug bundles can be found
+var ErrNoBundle = errors.New("no debug bundle found")
+
+// LogFile is the name of the file in each bundle containing the run's logs
+const LogFile = "ghstat.log"
+
+// bundleFormat is the format of the timestamp used to name each bundle
+const bundleFormat = "20060102T150405Z"
+
+// sensitiveWords are the words which mark a configuration key or log
+// attribute as holding a credential
+const sensitiveWords = `apikey|api_key|password|secret|token|seed|passphrase`
+
+// sensitiveKey matches configuration keys whose values should be redacted
+var sensitiveKey = regexp.MustCompile(`(?i)(` + sensitiveWords + `)`)
+
+// sensitiveLogAttr matches the key and value of sensitive attributes in a log
+// written by slog's text handler, where the value may be quoted
+var sensitiveLogAttr = regexp.MustCompile(`([\w.]*(?i:` + sensitiveWords + `)[\w.]*)=("(?:[^"\\]|\\.)*"|\S*)`)
+
+// Bundle is a directory into which diagnostics from a single run are saved
+type Bundle struct {
+	dir string
+}
+
+// NewBundle creates a new bundle directory in root, named for the given time
+func NewBundle(root string, now time.Time) (*Bundle, error) {
+	dir := filepath.Join(root, now.UTC().Format(bundleFormat))
+
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create debug bundle directory: %w", err)
+	}
+
+	return &Bundle{dir: dir}, nil
+}
+
+// Dir returns the path of the bundle directory
+func (b *Bundle) Dir() string {
+	return b.dir
+}
+
+// OpenLog opens the log file of the bundle for writing
+func (b *Bundle) OpenLog() (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(b.dir, LogFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open debug log file: %w", err)
+	}
+	return f, nil
+}
+
+// Latest returns the path of the most recent bundle in root
+func Latest(root string) (string, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrNoBundle
+		}
+		return "", fmt.Errorf("failed to read debug directory: %w", err)
+	}
+
+	names := []string{}
+	for _, e := range entries {
+		if _, err := time.Parse(bundleFormat, e.Name()); err == nil && e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+
+	if len(names) == 0 {
+		return "", ErrNoBundle
+	}
+
+	// The timestamp format sorts lexically in chronological order
+	sort.Strings(names)
+	return filepath.Join(root, names[len(names)-1]), nil
+}
+
+// Archive writes a zip archive to w containing the files in the bundle
+// directory dir, with the log redacted, along with a redacted copy of the
+// config file, if specified
+func Archive(w io.Writer, dir, configFile string) error {
+	zw := zip.NewWriter(w)
+	name := filepath.Base(dir)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if d.Name() == LogFile {
+			buf = RedactLog(buf)
+		}
+
+		return addFile(zw, filepath.ToSlash(filepath.Join(name, rel)), info.ModTime(), buf)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive debug bundle: %w", err)
+	}
+
+	if len(configFile) > 0 {
+		buf, err := os.ReadFile(configFile)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		redacted, err := RedactConfig(buf)
+		if err != nil {
+			return err
+		}
+
+		err = addFile(zw, name+"/ghstat.yaml", time.Now(), redacted)
+		if err != nil {
+			return fmt.Errorf("failed to archive config file: %w", err)
+		}
+	}
+
+	return zw.Close()
+}
+
+// RedactConfig replaces the values of any credentials in a YAML config file,
+// preserving the structure and comments of the rest of the file
+func RedactConfig(buf []byte) ([]byte, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(buf, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	redact(&doc)
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+
+	err = enc.Encode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode redacted config: %w", err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// RedactLog replaces the values of any sensitive attributes in a log written
+// by slog's text handler
+func RedactLog(buf []byte) []byte {
+	return sensitiveLogAttr.ReplaceAll(buf, []byte("${1}=REDACTED"))
+}
+
+// redact walks a YAML node, replacing the scalar values of sensitive keys
+func redact(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			if v.Kind == yaml.ScalarNode && sensitiveKey.MatchString(k.Value) {
+				v.SetString("REDACTED")
+				continue
+			}
+			redact(v)
+		}
+		return
+	}
+
+	for _, c := range n.Content {
+		redact(c)
+	}
+}
+
+// addFile adds a file with the given contents to a zip archive
+func addFile(zw *zip.Writer, name string, modified time.Time, buf []byte) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf)
+	return err
+}
@@ -0,0 +1,146 @@
+package debug
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactConfig(t *testing.T) {
+	config := `# Leads to report on
+leads:
+  - name: Joe Bloggs
+    roles:
+      - 1234
+metrics:
+  - key: appReviews
+    query:
+      in_stages[]: Application Review
+harvest:
+  url: https://harvest.greenhouse.io/v1
+  apiKey: hunter2
+`
+
+	buf, err := RedactConfig([]byte(config))
+	if err != nil {
+		t.Fatalf("failed to redact config: %s", err.Error())
+	}
+
+	redacted := string(buf)
+
+	if strings.Contains(redacted, "hunter2") {
+		t.Errorf("api key not redacted from config:\n%s", redacted)
+	}
+
+	for _, s := range []string{"# Leads to report on", "Joe Bloggs", "1234", "https://harvest.greenhouse.io/v1", "key: appReviews", "apiKey: REDACTED"} {
+		if !strings.Contains(redacted, s) {
+			t.Errorf("expected redacted config to contain '%s', got:\n%s", s, redacted)
+		}
+	}
+}
+
+func TestLatest(t *testing.T) {
+	root := t.TempDir()
+
+	_, err := Latest(root)
+	if !errors.Is(err, ErrNoBundle) {
+		t.Errorf("expected ErrNoBundle for an empty directory, got %v", err)
+	}
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, d := range []time.Duration{0, time.Hour, -time.Hour} {
+		if _, err := NewBundle(root, now.Add(d)); err != nil {
+			t.Fatalf("failed to create bundle: %s", err.Error())
+		}
+	}
+
+	// Unrelated directories should be ignored
+	os.Mkdir(filepath.Join(root, "zzz"), 0700)
+
+	dir, err := Latest(root)
+	if err != nil {
+		t.Fatalf("failed to find latest bundle: %s", err.Error())
+	}
+
+	if filepath.Base(dir) != "20240601T130000Z" {
+		t.Errorf("incorrect latest bundle, expected '20240601T130000Z', got '%s'", filepath.Base(dir))
+	}
+}
+
+func TestArchive(t *testing.T) {
+	b, err := NewBundle(t.TempDir(), time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to create bundle: %s", err.Error())
+	}
+
+	f, err := b.OpenLog()
+	if err != nil {
+		t.Fatalf("failed to open log: %s", err.Error())
+	}
+	f.WriteString("level=DEBUG msg=hello\n")
+	f.WriteString("level=DEBUG msg=\"logging in\" harvest.apiKey=\"hunter 2\" TOTP_SECRET=hunter3 role=123\n")
+	f.Close()
+
+	os.WriteFile(filepath.Join(b.Dir(), "1234-abcd.html"), []byte("<html></html>"), 0600)
+
+	configFile := filepath.Join(t.TempDir(), "ghstat.yaml")
+	os.WriteFile(configFile, []byte("harvest:\n  apiKey: hunter2\n"), 0600)
+
+	var buf bytes.Buffer
+	err = Archive(&buf, b.Dir(), configFile)
+	if err != nil {
+		t.Fatalf("failed to archive bundle: %s", err.Error())
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to read archive: %s", err.Error())
+	}
+
+	files := map[string]string{}
+	for _, zf := range zr.File {
+		r, _ := zf.Open()
+		content, _ := io.ReadAll(r)
+		r.Close()
+		files[zf.Name] = string(content)
+	}
+
+	for _, name := range []string{"20240601T120000Z/ghstat.log", "20240601T120000Z/1234-abcd.html", "20240601T120000Z/ghstat.yaml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected archive to contain '%s'", name)
+		}
+	}
+
+	if strings.Contains(files["20240601T120000Z/ghstat.yaml"], "hunter2") {
+		t.Errorf("archived config was not redacted")
+	}
+
+	log := files["20240601T120000Z/ghstat.log"]
+	if strings.Contains(log, "hunter") || !strings.Contains(log, "harvest.apiKey=REDACTED TOTP_SECRET=REDACTED role=123") {
+		t.Errorf("archived log was not redacted, got:\n%s", log)
+	}
+}
+
+func TestRedactAttr(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: RedactAttr}))
+
+	logger.Info("logging in", "password", "hunter2", "browser", "ws://user:hunter3@localhost:9222/devtools", "role", 123)
+
+	if strings.Contains(buf.String(), "hunter") {
+		t.Errorf("expected credentials to be redacted, got: %s", buf.String())
+	}
+
+	for _, s := range []string{"password=REDACTED", "localhost:9222", "role=123"} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected log to contain '%s', got: %s", s, buf.String())
+		}
+	}
+}
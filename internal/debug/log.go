@@ -0,0 +1,74 @@
+package debug
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/url"
+)
+
+// RedactAttr replaces the values of sensitive attributes, and any credentials
+// in URLs, as records are logged. It is intended for use as the ReplaceAttr
+// option of a slog.Handler.
+func RedactAttr(groups []string, a slog.Attr) slog.Attr {
+	if sensitiveKey.MatchString(a.Key) {
+		return slog.String(a.Key, "REDACTED")
+	}
+
+	if a.Value.Kind() == slog.KindString {
+		if u, err := url.Parse(a.Value.String()); err == nil && u.User != nil {
+			return slog.String(a.Key, u.Redacted())
+		}
+	}
+
+	return a
+}
+
+// teeHandler is a slog.Handler which passes each record to several handlers,
+// each of which applies its own level
+type teeHandler []slog.Handler
+
+// TeeHandler returns a slog.Handler which writes each record to all of the
+// specified handlers
+func TeeHandler(handlers ...slog.Handler) slog.Handler {
+	return teeHandler(handlers)
+}
+
+// Enabled reports whether any of the handlers handle records at the level
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle passes the record to each handler which is enabled for its level
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range t {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithAttrs returns a handler whose handlers each have the given attributes
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+// WithGroup returns a handler whose handlers each have the given group
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
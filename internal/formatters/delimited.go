@@ -0,0 +1,62 @@
+package formatters
+
+import (
+	"encoding/csv"
+	"io"
+	"jnsgruk/ghstat/internal/greenhouse"
+	"jnsgruk/ghstat/internal/history"
+	"log/slog"
+)
+
+// DelimitedFormatter outputs role statistics as comma or tab separated values,
+// quoted as described in RFC 4180, with the same columns as the tabular
+// formatters
+type DelimitedFormatter struct {
+	writer  io.Writer
+	metrics []greenhouse.Metric
+	comma   rune
+	header  bool
+}
+
+// SetHeader sets whether a header row is output before the values
+func (o *DelimitedFormatter) SetHeader(header bool) {
+	o.header = header
+}
+
+// Output dumps the role information to stdout as delimited values
+func (o *DelimitedFormatter) Output(roles []*greenhouse.Role) {
+	rows := [][]string{}
+	for _, r := range roles {
+		rows = append(rows, append([]string{r.Lead, title(r)}, valueCells(r, o.metrics)...))
+	}
+	o.write(headers(o.metrics), rows)
+}
+
+// OutputDiff dumps the changes in role information to stdout as delimited values
+func (o *DelimitedFormatter) OutputDiff(diff *history.Diff) {
+	rows := [][]string{}
+	for _, rd := range diff.Roles {
+		rows = append(rows, append([]string{rd.Lead, diffTitle(rd)}, deltaCells(rd, o.metrics)...))
+	}
+	o.write(headers(o.metrics), rows)
+}
+
+// OutputCandidates dumps the candidates for each role to stdout as delimited values
+func (o *DelimitedFormatter) OutputCandidates(lists []*greenhouse.CandidateList) {
+	o.write(candidateHeaders, candidateRows(lists))
+}
+
+// write outputs the rows, preceded by the header row if enabled
+func (o *DelimitedFormatter) write(header []string, rows [][]string) {
+	w := csv.NewWriter(o.writer)
+	w.Comma = o.comma
+
+	if o.header {
+		rows = append([][]string{header}, rows...)
+	}
+
+	err := w.WriteAll(rows)
+	if err != nil {
+		slog.Error("could not write output data", "error", err.Error())
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"io"
 	"jnsgruk/ghstat/internal/greenhouse"
+	"jnsgruk/ghstat/internal/history"
 	"log/slog"
 	"strconv"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/fbiville/markdown-table-formatter/pkg/markdown"
@@ -18,15 +20,41 @@ type Formatter interface {
 	Output(roles []*greenhouse.Role)
 }
 
-// NewFormatter constructs a formatter of the requested type
-func NewFormatter(input string, writer io.Writer) Formatter {
+// DiffFormatter is implemented by formatters which can output the changes in
+// role statistics since a previous run
+type DiffFormatter interface {
+	OutputDiff(diff *history.Diff)
+}
+
+// CandidateFormatter is implemented by formatters which can output the
+// candidates behind a metric for a set of roles
+type CandidateFormatter interface {
+	OutputCandidates(lists []*greenhouse.CandidateList)
+}
+
+// HeaderFormatter is implemented by formatters whose header row can be omitted
+type HeaderFormatter interface {
+	SetHeader(header bool)
+}
+
+// NewFormatter constructs a formatter of the requested type, which will output
+// a column for each of the specified metrics
+func NewFormatter(input string, metrics []greenhouse.Metric, writer io.Writer) Formatter {
 	switch input {
 	case "pretty":
-		return &PrettyTableFormatter{writer: writer}
+		return &PrettyTableFormatter{writer: writer, metrics: metrics}
 	case "markdown":
-		return &MarkdownTableFormatter{writer: writer}
+		return &MarkdownTableFormatter{writer: writer, metrics: metrics}
 	case "json":
 		return &JsonFormatter{writer: writer}
+	case "openmetrics":
+		return &OpenMetricsFormatter{writer: writer, metrics: metrics}
+	case "csv":
+		return &DelimitedFormatter{writer: writer, metrics: metrics, comma: ',', header: true}
+	case "tsv":
+		return &DelimitedFormatter{writer: writer, metrics: metrics, comma: '\t', header: true}
+	case "html":
+		return &HTMLFormatter{writer: writer, metrics: metrics}
 	default:
 		return nil
 	}
@@ -47,38 +75,75 @@ func (o *JsonFormatter) Output(roles []*greenhouse.Role) {
 	fmt.Fprint(o.writer, string(b))
 }
 
+// OutputDiff dumps the changes in role information to stdout as JSON
+func (o *JsonFormatter) OutputDiff(diff *history.Diff) {
+	b, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		slog.Error("could not marshal output data", "error", err.Error())
+	}
+	fmt.Fprint(o.writer, string(b))
+}
+
+// OutputCandidates dumps the candidates for each role to stdout as JSON
+func (o *JsonFormatter) OutputCandidates(lists []*greenhouse.CandidateList) {
+	b, err := json.MarshalIndent(lists, "", "  ")
+	if err != nil {
+		slog.Error("could not marshal output data", "error", err.Error())
+	}
+	fmt.Fprint(o.writer, string(b))
+}
+
 // MarkdownTableFormatter is used for rendering stats as a Markdown table
 type MarkdownTableFormatter struct {
-	writer io.Writer
+	writer  io.Writer
+	metrics []greenhouse.Metric
 }
 
 // Output dumps the role information as a Markdown table to stdout
 func (o *MarkdownTableFormatter) Output(roles []*greenhouse.Role) {
 	rows := [][]string{}
 	for _, r := range roles {
-		rows = append(rows, []string{
-			r.Lead,
-			r.Title,
-			strconv.Itoa(r.AppReviews()),
-			strconv.Itoa(r.NeedsDecision()),
-			strconv.Itoa(r.NeedsScheduling()),
-			strconv.Itoa(r.WIScreening()),
-			strconv.Itoa(r.WIGrading()),
-			strconv.Itoa(r.Stale()),
-		})
+		rows = append(rows, append([]string{r.Lead, title(r)}, valueCells(r, o.metrics)...))
 	}
 
 	tbl, _ := markdown.NewTableFormatterBuilder().
 		WithPrettyPrint().
-		Build("Lead", "Role", "CVs", "Decisions", "Scheduling", "WI (Screen)", "WI (Grade)", "Stale").
+		Build(headers(o.metrics)...).
 		Format(rows)
 
 	fmt.Fprint(o.writer, tbl)
 }
 
+// OutputDiff dumps the changes in role information as a Markdown table to stdout
+func (o *MarkdownTableFormatter) OutputDiff(diff *history.Diff) {
+	rows := [][]string{}
+	for _, rd := range diff.Roles {
+		rows = append(rows, append([]string{rd.Lead, diffTitle(rd)}, deltaCells(rd, o.metrics)...))
+	}
+
+	tbl, _ := markdown.NewTableFormatterBuilder().
+		WithPrettyPrint().
+		Build(headers(o.metrics)...).
+		Format(rows)
+
+	fmt.Fprintf(o.writer, "Changes since %s\n\n", diff.Since.Local().Format(time.DateTime))
+	fmt.Fprint(o.writer, tbl)
+}
+
+// OutputCandidates dumps the candidates for each role as a Markdown table to stdout
+func (o *MarkdownTableFormatter) OutputCandidates(lists []*greenhouse.CandidateList) {
+	tbl, _ := markdown.NewTableFormatterBuilder().
+		WithPrettyPrint().
+		Build(candidateHeaders...).
+		Format(candidateRows(lists))
+
+	fmt.Fprint(o.writer, tbl)
+}
+
 // PrettyTableFormatter dumps the role information to a pretty printed terminal
 type PrettyTableFormatter struct {
-	writer io.Writer
+	writer  io.Writer
+	metrics []greenhouse.Metric
 }
 
 // Output dumps the pretty table to stdout
@@ -86,20 +151,153 @@ func (o *PrettyTableFormatter) Output(roles []*greenhouse.Role) {
 	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
 	columnFmt := color.New(color.FgYellow).SprintfFunc()
 
-	tbl := table.New("Lead", "Role", "CVs", "Decisions", "Scheduling", "WI (Screen)", "WI (Grade)", "Stale").WithWriter(o.writer)
+	columns := []any{}
+	for _, h := range headers(o.metrics) {
+		columns = append(columns, h)
+	}
+
+	tbl := table.New(columns...).WithWriter(o.writer)
 	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
 
 	for _, r := range roles {
-		tbl.AddRow(
-			r.Lead,
-			r.Title,
-			r.AppReviews(),
-			r.NeedsDecision(),
-			r.NeedsScheduling(),
-			r.WIScreening(),
-			r.WIGrading(),
-			r.Stale(),
-		)
+		row := []any{r.Lead, title(r)}
+		for _, c := range valueCells(r, o.metrics) {
+			row = append(row, c)
+		}
+		tbl.AddRow(row...)
+	}
+	tbl.Print()
+}
+
+// OutputDiff dumps a pretty table of the changes in role information to stdout
+func (o *PrettyTableFormatter) OutputDiff(diff *history.Diff) {
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	columns := []any{}
+	for _, h := range headers(o.metrics) {
+		columns = append(columns, h)
+	}
+
+	tbl := table.New(columns...).WithWriter(o.writer)
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+
+	for _, rd := range diff.Roles {
+		row := []any{rd.Lead, diffTitle(rd)}
+		for _, c := range deltaCells(rd, o.metrics) {
+			row = append(row, c)
+		}
+		tbl.AddRow(row...)
+	}
+
+	fmt.Fprintf(o.writer, "Changes since %s\n\n", diff.Since.Local().Format(time.DateTime))
+	tbl.Print()
+}
+
+// OutputCandidates dumps a pretty table of the candidates for each role to stdout
+func (o *PrettyTableFormatter) OutputCandidates(lists []*greenhouse.CandidateList) {
+	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
+	columnFmt := color.New(color.FgYellow).SprintfFunc()
+
+	columns := []any{}
+	for _, h := range candidateHeaders {
+		columns = append(columns, h)
+	}
+
+	tbl := table.New(columns...).WithWriter(o.writer)
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+
+	for _, r := range candidateRows(lists) {
+		row := []any{}
+		for _, c := range r {
+			row = append(row, c)
+		}
+		tbl.AddRow(row...)
 	}
 	tbl.Print()
 }
+
+// candidateHeaders are the column headers for tabular output of candidates
+var candidateHeaders = []string{"Lead", "Role", "Candidate", "ID", "Stage", "Last Activity", "Link"}
+
+// candidateRows renders a row for each candidate in a set of candidate lists
+func candidateRows(lists []*greenhouse.CandidateList) [][]string {
+	rows := [][]string{}
+	for _, l := range lists {
+		for _, c := range l.Candidates {
+			rows = append(rows, []string{l.Lead, l.Title, c.Name, strconv.FormatInt(c.ID, 10), c.Stage, c.LastActivity, c.URL})
+		}
+	}
+	return rows
+}
+
+// deltaCells renders the current value of each metric for a role, alongside
+// a marker showing whether it has gone up or down since the previous run
+func deltaCells(rd history.RoleDiff, metrics []greenhouse.Metric) []string {
+	cells := []string{}
+	for _, m := range metrics {
+		d, _ := rd.Delta(m.Key)
+
+		switch {
+		case d.Current == nil:
+			cells = append(cells, unknown)
+		case d.Previous == nil:
+			cells = append(cells, fmt.Sprintf("%d (new)", *d.Current))
+		case d.Change > 0:
+			cells = append(cells, fmt.Sprintf("%d (↑%d)", *d.Current, d.Change))
+		case d.Change < 0:
+			cells = append(cells, fmt.Sprintf("%d (↓%d)", *d.Current, -d.Change))
+		default:
+			cells = append(cells, fmt.Sprintf("%d (=)", *d.Current))
+		}
+	}
+	return cells
+}
+
+// unknown is displayed in place of values which could not be retrieved
+const unknown = "?"
+
+// title returns the title of a role, or a placeholder if it could not be retrieved
+func title(r *greenhouse.Role) string {
+	if r.TitleErr() != nil {
+		return unknown
+	}
+	return r.Title
+}
+
+// diffTitle returns the title of a role in a diff, or a placeholder if it
+// could not be retrieved
+func diffTitle(rd history.RoleDiff) string {
+	if len(rd.Title) == 0 {
+		return unknown
+	}
+	return rd.Title
+}
+
+// valueCells renders the value of each metric for a role, or a placeholder
+// where the value could not be retrieved
+func valueCells(r *greenhouse.Role, metrics []greenhouse.Metric) []string {
+	cells := []string{}
+	for _, m := range metrics {
+		cells = append(cells, value(r, m.Key))
+	}
+	return cells
+}
+
+// value returns the value of the metric with the specified key for a role, or
+// a placeholder if it could not be retrieved
+func value(r *greenhouse.Role, key string) string {
+	if v := r.Result(key); v.Known() {
+		return strconv.Itoa(v.Count)
+	}
+	return unknown
+}
+
+// headers returns the column headers for tabular output of the given metrics
+func headers(metrics []greenhouse.Metric) []string {
+	h := []string{"Lead", "Role"}
+	for _, m := range metrics {
+		h = append(h, m.ColumnLabel())
+	}
+	return h
+}
@@ -0,0 +1,117 @@
+package formatters
+
+import (
+	_ "embed"
+	"html/template"
+	"io"
+	"jnsgruk/ghstat/internal/greenhouse"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// LinkFormatter is implemented by formatters which link to the Greenhouse
+// candidates page behind each value
+type LinkFormatter interface {
+	SetBaseURL(baseUrl *url.URL)
+}
+
+//go:embed report.html
+var reportTemplate string
+
+// report is the template for the HTML report
+var report = template.Must(template.New("report").Parse(reportTemplate))
+
+// HTMLFormatter outputs role statistics as a self-contained HTML report, with
+// a sortable table for each lead. Each value links to the filtered candidates
+// page it was counted from, and rows are highlighted where a value reaches the
+// thresholds configured for its metric.
+type HTMLFormatter struct {
+	writer  io.Writer
+	metrics []greenhouse.Metric
+	baseUrl *url.URL
+}
+
+// SetBaseURL sets the address of the Greenhouse instance linked to from the
+// report
+func (o *HTMLFormatter) SetBaseURL(baseUrl *url.URL) {
+	o.baseUrl = baseUrl
+}
+
+// htmlLead is a lead and the rows for their roles, as shown in the report
+type htmlLead struct {
+	Name string
+	Rows []htmlRow
+}
+
+// htmlRow is a role, as shown in the report
+type htmlRow struct {
+	Title string
+	URL   string
+	Level string
+	Cells []htmlCell
+}
+
+// htmlCell is the value of a metric for a role, as shown in the report
+type htmlCell struct {
+	Value string
+	Known bool
+	Sort  int
+	URL   string
+	Level string
+}
+
+// Output dumps the role information to stdout as an HTML report
+func (o *HTMLFormatter) Output(roles []*greenhouse.Role) {
+	baseUrl := o.baseUrl
+	if baseUrl == nil {
+		baseUrl, _ = greenhouse.ParseBaseURL(greenhouse.DefaultBaseURL)
+	}
+
+	leads := []htmlLead{}
+	for _, r := range roles {
+		if len(leads) == 0 || leads[len(leads)-1].Name != r.Lead {
+			leads = append(leads, htmlLead{Name: r.Lead})
+		}
+
+		row := htmlRow{
+			Title: title(r),
+			URL:   greenhouse.CandidatesURL(baseUrl, r.ID, nil).String(),
+		}
+
+		for _, m := range o.metrics {
+			cell := htmlCell{Value: unknown, Sort: -1}
+			v := r.Result(m.Key)
+
+			if v.Known() {
+				cell.Value, cell.Known, cell.Sort = strconv.Itoa(v.Count), true, v.Count
+				cell.Level = m.Thresholds.Level(v.Count)
+			}
+
+			// Link with the queries the value was counted with, so that the
+			// dates match even if the report is rendered on a later day
+			if v.Queries != nil {
+				cell.URL = greenhouse.CandidatesURL(baseUrl, r.ID, v.Queries).String()
+			}
+
+			if cell.Level == greenhouse.LevelCritical || (cell.Level == greenhouse.LevelWarning && len(row.Level) == 0) {
+				row.Level = cell.Level
+			}
+
+			row.Cells = append(row.Cells, cell)
+		}
+
+		lead := &leads[len(leads)-1]
+		lead.Rows = append(lead.Rows, row)
+	}
+
+	err := report.Execute(o.writer, map[string]any{
+		"Generated": time.Now(),
+		"Metrics":   o.metrics,
+		"Leads":     leads,
+	})
+	if err != nil {
+		slog.Error("could not render report", "error", err.Error())
+	}
+}
@@ -0,0 +1,143 @@
+package formatters
+
+import (
+	"fmt"
+	"io"
+	"jnsgruk/ghstat/internal/greenhouse"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpenMetricsContentType is the content type of the OpenMetrics text format
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Scrape describes how the statistics output by a formatter were gathered
+type Scrape struct {
+	// Duration is how long it took to gather the statistics
+	Duration time.Duration
+	// Errors is the number of values which could not be retrieved
+	Errors int
+}
+
+// NewScrape describes the gathering of statistics for roles, which took the
+// specified duration
+func NewScrape(roles []*greenhouse.Role, duration time.Duration) Scrape {
+	errs := 0
+	for _, r := range roles {
+		errs += len(r.Errors())
+	}
+	return Scrape{Duration: duration, Errors: errs}
+}
+
+// ScrapeFormatter is implemented by formatters which can output details of how
+// the statistics were gathered
+type ScrapeFormatter interface {
+	SetScrape(scrape Scrape)
+}
+
+// OpenMetricsFormatter outputs role statistics in the OpenMetrics text format,
+// with a gauge family for each metric, labelled with the lead, role ID and
+// role title of each role. Values which could not be retrieved are omitted.
+type OpenMetricsFormatter struct {
+	writer  io.Writer
+	metrics []greenhouse.Metric
+	scrape  *Scrape
+}
+
+// SetScrape sets the details of how the statistics were gathered, which are
+// output as gauges alongside the statistics
+func (o *OpenMetricsFormatter) SetScrape(scrape Scrape) {
+	o.scrape = &scrape
+}
+
+// Output dumps the role information to stdout in the OpenMetrics format
+func (o *OpenMetricsFormatter) Output(roles []*greenhouse.Role) {
+	var b strings.Builder
+
+	for _, m := range o.metrics {
+		name := "ghstat_" + metricName(m.Key)
+
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		if len(m.Description) > 0 {
+			fmt.Fprintf(&b, "# HELP %s %s\n", name, escape(m.Description))
+		}
+
+		for _, r := range roles {
+			v := r.Result(m.Key)
+			if !v.Known() {
+				continue
+			}
+
+			fmt.Fprintf(&b, "%s{lead=\"%s\",role_id=\"%d\",role_title=\"%s\"} %d\n",
+				name, escape(r.Lead), r.ID, escape(r.Title), v.Count)
+		}
+	}
+
+	if o.scrape != nil {
+		b.WriteString("# TYPE ghstat_scrape_duration_seconds gauge\n")
+		b.WriteString("# HELP ghstat_scrape_duration_seconds How long it took to gather the statistics from Greenhouse\n")
+		fmt.Fprintf(&b, "ghstat_scrape_duration_seconds %s\n", strconv.FormatFloat(o.scrape.Duration.Seconds(), 'f', -1, 64))
+
+		b.WriteString("# TYPE ghstat_scrape_errors gauge\n")
+		b.WriteString("# HELP ghstat_scrape_errors The number of values which could not be retrieved from Greenhouse\n")
+		fmt.Fprintf(&b, "ghstat_scrape_errors %d\n", o.scrape.Errors)
+	}
+
+	b.WriteString("# EOF\n")
+	fmt.Fprint(o.writer, b.String())
+}
+
+// reservedMetricNames are the names of the gauges which describe how the
+// statistics were gathered, which no metric may share
+var reservedMetricNames = []string{"ghstat_scrape_duration_seconds", "ghstat_scrape_errors"}
+
+// ValidateOpenMetrics ensures that the gauge family of each metric has a
+// distinct name, which isn't reserved for the gauges describing the scrape
+func ValidateOpenMetrics(metrics []greenhouse.Metric) error {
+	seen := map[string]string{}
+
+	for _, m := range metrics {
+		name := "ghstat_" + metricName(m.Key)
+
+		if slices.Contains(reservedMetricNames, name) {
+			return fmt.Errorf("metric key '%s' cannot be used with openmetrics output, as '%s' is reserved", m.Key, name)
+		}
+
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("metric keys '%s' and '%s' would both be output as '%s', please rename one of them", other, m.Key, name)
+		}
+		seen[name] = m.Key
+	}
+
+	return nil
+}
+
+// metricName converts a metric key, such as 'appReviews', into a valid
+// OpenMetrics metric name in snake case, such as 'app_reviews'
+func metricName(key string) string {
+	var b strings.Builder
+
+	for i, r := range key {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r + 'a' - 'A')
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+
+	return b.String()
+}
+
+// escape escapes a label value or the text of a HELP line for the OpenMetrics
+// text format
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
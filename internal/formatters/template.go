@@ -0,0 +1,260 @@
+package formatters
+
+import (
+	"cmp"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"jnsgruk/ghstat/internal/greenhouse"
+	"log/slog"
+	"maps"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// TemplateData is the data passed to a user-supplied template
+type TemplateData struct {
+	// Roles are the roles statistics were gathered for, sorted by lead, then
+	// by the value of the first metric
+	Roles []*greenhouse.Role
+	// Leads are the roles grouped by lead, in the same order
+	Leads []TemplateGroup
+	// Metrics are the configured metrics, in the order they were configured
+	Metrics []greenhouse.Metric
+	// Totals are the sum of the known values of each metric, keyed by the
+	// metric's key
+	Totals map[string]int
+	// Run describes the run which gathered the statistics
+	Run TemplateRun
+}
+
+// TemplateGroup is a set of roles which share the value of a field
+type TemplateGroup struct {
+	Name  string
+	Roles []*greenhouse.Role
+}
+
+// TemplateRun describes the run which gathered the statistics output by a
+// template
+type TemplateRun struct {
+	// Generated is the time the template was rendered
+	Generated time.Time
+	// Duration is how long it took to gather the statistics
+	Duration time.Duration
+	// Errors is the number of values which could not be retrieved
+	Errors int
+}
+
+// executor is implemented by both text and HTML templates
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// TemplateFormatter renders role statistics through a user-supplied Go
+// template. Templates with the '.html' extension are rendered with
+// html/template, so that values are escaped, and all others with
+// text/template.
+type TemplateFormatter struct {
+	writer  io.Writer
+	metrics []greenhouse.Metric
+	tmpl    executor
+	baseUrl *url.URL
+	scrape  Scrape
+}
+
+// NewTemplateFormatter parses the template at path, returning a formatter
+// which renders statistics for the specified metrics through it
+func NewTemplateFormatter(path string, metrics []greenhouse.Metric, writer io.Writer) (*TemplateFormatter, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("no template file specified")
+	}
+
+	o := &TemplateFormatter{writer: writer, metrics: metrics}
+
+	var err error
+	name := filepath.Base(path)
+
+	if strings.EqualFold(filepath.Ext(path), ".html") {
+		o.tmpl, err = htmltemplate.New(name).Funcs(o.funcs()).ParseFiles(path)
+	} else {
+		o.tmpl, err = texttemplate.New(name).Funcs(o.funcs()).ParseFiles(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	return o, nil
+}
+
+// SetBaseURL sets the address of the Greenhouse instance linked to by the
+// 'greenhouseURL' function
+func (o *TemplateFormatter) SetBaseURL(baseUrl *url.URL) {
+	o.baseUrl = baseUrl
+}
+
+// SetScrape sets the details of how the statistics were gathered, which are
+// available to the template as '.Run'
+func (o *TemplateFormatter) SetScrape(scrape Scrape) {
+	o.scrape = scrape
+}
+
+// Output renders the role information through the template to stdout
+func (o *TemplateFormatter) Output(roles []*greenhouse.Role) {
+	totals := map[string]int{}
+	for _, m := range o.metrics {
+		totals[m.Key], _ = o.sum(m.Key, roles)
+	}
+
+	leads, _ := groupBy("lead", roles)
+
+	data := TemplateData{
+		Roles:   roles,
+		Leads:   leads,
+		Metrics: o.metrics,
+		Totals:  totals,
+		Run: TemplateRun{
+			Generated: time.Now(),
+			Duration:  o.scrape.Duration,
+			Errors:    o.scrape.Errors,
+		},
+	}
+
+	err := o.tmpl.Execute(o.writer, data)
+	if err != nil {
+		slog.Error("could not render template", "error", err.Error())
+	}
+}
+
+// funcs returns the helper functions available to templates
+func (o *TemplateFormatter) funcs() map[string]any {
+	funcs := RoleFuncs()
+	maps.Copy(funcs, map[string]any{
+		"sum":           o.sum,
+		"groupBy":       groupBy,
+		"sortBy":        o.sortBy,
+		"greenhouseURL": o.greenhouseURL,
+	})
+	return funcs
+}
+
+// RoleFuncs returns the template functions which render the title and values
+// of a role as they are shown in tabular output, with a placeholder for any
+// that could not be retrieved
+func RoleFuncs() map[string]any {
+	return map[string]any{
+		"title": title,
+		"value": value,
+	}
+}
+
+// greenhouseURL returns the address of the candidates page for a role,
+// filtered with the queries the value of the metric with the specified key
+// was counted with, if one is given
+func (o *TemplateFormatter) greenhouseURL(r *greenhouse.Role, key ...string) (string, error) {
+	baseUrl := o.baseUrl
+	if baseUrl == nil {
+		baseUrl, _ = greenhouse.ParseBaseURL(greenhouse.DefaultBaseURL)
+	}
+
+	if len(key) == 0 {
+		return greenhouse.CandidatesURL(baseUrl, r.ID, nil).String(), nil
+	}
+
+	if err := o.checkMetric(key[0]); err != nil {
+		return "", err
+	}
+	return greenhouse.CandidatesURL(baseUrl, r.ID, r.Result(key[0]).Queries).String(), nil
+}
+
+// checkMetric returns an error if key is not the key of one of the metrics
+// being output, so that a misspelt key fails rather than rendering zeroes
+func (o *TemplateFormatter) checkMetric(key string) error {
+	if !slices.ContainsFunc(o.metrics, func(m greenhouse.Metric) bool { return m.Key == key }) {
+		return fmt.Errorf("unknown metric '%s'", key)
+	}
+	return nil
+}
+
+// sum returns the total of the known values of a metric across roles
+func (o *TemplateFormatter) sum(key string, roles []*greenhouse.Role) (int, error) {
+	if err := o.checkMetric(key); err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, r := range roles {
+		total += r.Value(key)
+	}
+	return total, nil
+}
+
+// groupBy groups roles by their 'lead' or 'title', in the order each group
+// first appears
+func groupBy(field string, roles []*greenhouse.Role) ([]TemplateGroup, error) {
+	groups := []TemplateGroup{}
+	index := map[string]int{}
+
+	for _, r := range roles {
+		var name string
+		switch field {
+		case "lead":
+			name = r.Lead
+		case "title":
+			name = title(r)
+		default:
+			return nil, fmt.Errorf("cannot group roles by '%s', please choose 'lead' or 'title'", field)
+		}
+
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, TemplateGroup{Name: name})
+		}
+		groups[i].Roles = append(groups[i].Roles, r)
+	}
+
+	return groups, nil
+}
+
+// sortBy returns a copy of roles sorted in ascending order by their 'id',
+// 'lead', 'title', or the value of the metric with the specified key. The
+// field may be prefixed with '-' to sort in descending order.
+func (o *TemplateFormatter) sortBy(field string, roles []*greenhouse.Role) ([]*greenhouse.Role, error) {
+	desc := strings.HasPrefix(field, "-")
+	field = strings.TrimPrefix(field, "-")
+
+	switch field {
+	case "id", "lead", "title":
+	default:
+		if err := o.checkMetric(field); err != nil {
+			return nil, err
+		}
+	}
+
+	sorted := slices.Clone(roles)
+	slices.SortStableFunc(sorted, func(a, b *greenhouse.Role) int {
+		var c int
+		switch field {
+		case "id":
+			c = cmp.Compare(a.ID, b.ID)
+		case "lead":
+			c = cmp.Compare(a.Lead, b.Lead)
+		case "title":
+			c = cmp.Compare(title(a), title(b))
+		default:
+			c = cmp.Compare(a.Value(field), b.Value(field))
+		}
+
+		if desc {
+			return -c
+		}
+		return c
+	})
+
+	return sorted, nil
+}
@@ -0,0 +1,91 @@
+package ghstat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"jnsgruk/ghstat/internal/credentials"
+	"jnsgruk/ghstat/internal/greenhouse"
+)
+
+// StoreCredentials prompts for each of the credentials used to log in with the
+// specified provider, and saves them in the system keyring
+func StoreCredentials(ctx context.Context, provider string, prompter greenhouse.Prompter, keyring credentials.Keyring) error {
+	if !keyring.Available() {
+		return credentials.ErrNoKeyring
+	}
+
+	auth, err := greenhouse.NewAuthenticator(provider, greenhouse.Credentials{Prompter: prompter}, greenhouse.TOTPSecret{})
+	if err != nil {
+		return err
+	}
+
+	creds := auth.Credentials()
+	if len(creds) == 0 {
+		return fmt.Errorf("the '%s' login provider doesn't use any credentials", provider)
+	}
+
+	for _, cred := range creds {
+		value, err := prompter.Prompt(cred.Label, cred.Secret)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", cred.Name, err)
+		}
+
+		err = keyring.Store(ctx, cred.Name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// errNotBrowser is returned by session management when the browser backend,
+// which is the only backend to use a session, is not selected
+var errNotBrowser = errors.New("sessions are only used by the 'browser' backend")
+
+// Login runs the login flow against Greenhouse, saving the session's cookies,
+// without gathering any statistics
+func Login(ctx context.Context, conf *config) error {
+	if !usesSession(conf) {
+		return errNotBrowser
+	}
+
+	gh, err := NewGreenhouseClient(conf)
+	if err != nil {
+		return err
+	}
+	defer gh.Close()
+
+	return gh.Login(ctx)
+}
+
+// Logout removes the cookies saved by a previous login
+func Logout(conf *config) error {
+	if !usesSession(conf) {
+		return errNotBrowser
+	}
+	return greenhouse.ClearSession(browserOptions(conf))
+}
+
+// Status reports the session saved by a previous login, and whether it is
+// still valid
+func Status(ctx context.Context, conf *config) (*greenhouse.Session, error) {
+	if !usesSession(conf) {
+		return nil, errNotBrowser
+	}
+
+	gh, err := greenhouse.NewGreenhouse(browserOptions(conf))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create greenhouse client: %w", err)
+	}
+	defer gh.Close()
+
+	return gh.Status(ctx)
+}
+
+// usesSession reports whether the configured backend uses a Greenhouse session
+func usesSession(conf *config) bool {
+	return conf.Backend == "" || conf.Backend == "browser"
+}
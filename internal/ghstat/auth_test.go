@@ -0,0 +1,50 @@
+package ghstat
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"jnsgruk/ghstat/internal/credentials"
+	"jnsgruk/ghstat/internal/credentials/credentialstest"
+	"jnsgruk/ghstat/internal/greenhouse"
+)
+
+func TestStoreCredentials(t *testing.T) {
+	keyring := credentialstest.NewKeyring(t)
+
+	prompter := &credentialstest.Prompter{Values: map[string]string{
+		"Greenhouse Email":    "joe@example.com",
+		"Greenhouse Password": "hunter2",
+	}}
+
+	err := StoreCredentials(context.Background(), greenhouse.LoginProviderGreenhouse, prompter, keyring)
+	if err != nil {
+		t.Fatalf("failed to store credentials: %s", err.Error())
+	}
+
+	for name, expected := range map[string]string{
+		"greenhouse/login":    "joe@example.com",
+		"greenhouse/password": "hunter2",
+	} {
+		value, err := keyring.Get(context.Background(), name)
+		if err != nil || value != expected {
+			t.Errorf("incorrect credential '%s' in keyring, expected '%s', got '%s' (%v)", name, expected, value, err)
+		}
+	}
+}
+
+func TestStoreCredentialsFailure(t *testing.T) {
+	keyring := credentialstest.NewKeyring(t)
+
+	err := StoreCredentials(context.Background(), greenhouse.LoginProviderNone, &credentialstest.Prompter{}, keyring)
+	if err == nil {
+		t.Errorf("expected an error storing credentials for a provider without any")
+	}
+
+	err = StoreCredentials(context.Background(), "", &credentialstest.Prompter{}, credentials.Keyring{Path: filepath.Join(t.TempDir(), "missing")})
+	if !errors.Is(err, credentials.ErrNoKeyring) {
+		t.Errorf("expected ErrNoKeyring without a keyring, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package ghstat
+
+import (
+	"fmt"
+	"os"
+
+	"jnsgruk/ghstat/internal/credentials"
+	"jnsgruk/ghstat/internal/greenhouse"
+)
+
+// NewGreenhouseClient constructs a client for the backend selected in the
+// configuration, defaulting to driving a browser against the Greenhouse UI
+func NewGreenhouseClient(conf *config) (greenhouse.GreenhouseClient, error) {
+	switch conf.Backend {
+	case "", "browser":
+		gh, err := greenhouse.NewGreenhouse(browserOptions(conf))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create greenhouse client: %w", err)
+		}
+		return gh, nil
+	case "harvest":
+		if len(conf.RecordDir) > 0 || len(conf.ReplayDir) > 0 {
+			return nil, fmt.Errorf("recording and replaying pages is only supported by the 'browser' backend")
+		}
+
+		if len(conf.Browser.URL) > 0 {
+			return nil, fmt.Errorf("a browser url is only supported by the 'browser' backend")
+		}
+
+		err := greenhouse.ValidateHarvestMetrics(conf.Metrics)
+		if err != nil {
+			return nil, err
+		}
+
+		apiKey := os.Getenv("GREENHOUSE_API_KEY")
+		if len(apiKey) == 0 {
+			apiKey = conf.Harvest.APIKey
+		}
+		return greenhouse.NewHarvest(conf.Harvest.URL, apiKey, conf.Greenhouse.URL), nil
+	default:
+		return nil, fmt.Errorf("invalid backend '%s', please choose one of 'browser' or 'harvest'", conf.Backend)
+	}
+}
+
+// browserOptions returns the options for the browser backend's client
+func browserOptions(conf *config) greenhouse.Options {
+	opts := greenhouse.Options{
+		RecordDir:         conf.RecordDir,
+		ReplayDir:         conf.ReplayDir,
+		BrowserURL:        conf.Browser.URL,
+		DebugDir:          conf.DebugDir,
+		BaseURL:           conf.Greenhouse.URL,
+		LoginProvider:     conf.Greenhouse.Login.Provider,
+		LoginURLPatterns:  conf.Greenhouse.Login.URLPatterns,
+		CredentialSources: credentialSources(conf),
+		CookieEncryption:  conf.Greenhouse.Cookies.Encryption,
+		TOTPSecret: greenhouse.TOTPSecret{
+			File:    conf.Greenhouse.Login.TOTP.SecretFile,
+			Command: conf.Greenhouse.Login.TOTP.SecretCommand,
+		},
+	}
+
+	if conf.NonInteractive {
+		opts.Prompter = greenhouse.NonInteractivePrompter{}
+	}
+
+	return opts
+}
+
+// credentialSources returns the sources from which credentials used to log in
+// are read: the configured credential command, then the system keyring, if it
+// is available and not disabled
+func credentialSources(conf *config) []credentials.Source {
+	sources := []credentials.Source{}
+
+	if len(conf.Greenhouse.Login.Credentials.Command) > 0 {
+		sources = append(sources, credentials.Command{Command: conf.Greenhouse.Login.Credentials.Command})
+	}
+
+	keyring := credentials.Keyring{}
+	if !conf.Greenhouse.Login.Credentials.DisableKeyring && keyring.Available() {
+		sources = append(sources, keyring)
+	}
+
+	return sources
+}
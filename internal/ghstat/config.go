@@ -2,19 +2,47 @@ package ghstat
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"slices"
+	"time"
+
+	"jnsgruk/ghstat/internal/greenhouse"
+	"jnsgruk/ghstat/internal/history"
 
 	"github.com/spf13/viper"
 )
 
 // config represents ghstat's configuration format
 type config struct {
-	Leads []lead `yaml:"leads"`
+	Leads      []lead                 `yaml:"leads"`
+	Metrics    []greenhouse.Metric    `yaml:"metrics"`
+	Backend    string                 `yaml:"backend"`
+	Greenhouse greenhouseConfig       `yaml:"greenhouse"`
+	Browser    browserConfig          `yaml:"browser"`
+	Harvest    harvestConfig          `yaml:"harvest"`
+	History    historyConfig          `yaml:"history"`
+	Retry      greenhouse.RetryPolicy `yaml:"retry"`
+	Serve      serveConfig            `yaml:"serve"`
 	// The following are added at runtime according to CLI flags
-	Verbose   bool
-	Filter    []string
-	Formatter string
+	Verbose        bool
+	Filter         []string
+	Formatter      string
+	Template       string
+	NoHeader       bool
+	RecordDir      string
+	ReplayDir      string
+	Diff           bool
+	Since          string
+	Strict         bool
+	DebugDir       string
+	List           string
+	ListRole       int64
+	NonInteractive bool
 }
 
 // lead is a Canonical Hiring lead, who has a name and zero or more hiring roles
@@ -24,9 +52,77 @@ type lead struct {
 	Roles []int64 `yaml:"roles"`
 }
 
+// greenhouseConfig configures the Greenhouse instance, and how to log in to it
+type greenhouseConfig struct {
+	URL     string        `yaml:"url"`
+	Login   loginConfig   `yaml:"login"`
+	Cookies cookiesConfig `yaml:"cookies"`
+}
+
+// cookiesConfig configures how the cookies saved between sessions are stored
+type cookiesConfig struct {
+	Encryption string `yaml:"encryption"`
+}
+
+// loginConfig configures the SSO provider used to log in to Greenhouse
+type loginConfig struct {
+	Provider    string            `yaml:"provider"`
+	URLPatterns []string          `yaml:"urlPatterns"`
+	TOTP        totpConfig        `yaml:"totp"`
+	Credentials credentialsConfig `yaml:"credentials"`
+}
+
+// credentialsConfig configures where the credentials used to log in are read
+// from, before falling back to environment variables and prompting
+type credentialsConfig struct {
+	Command        string `yaml:"command"`
+	DisableKeyring bool   `yaml:"disableKeyring"`
+}
+
+// totpConfig configures where to find the seed used to generate one-time
+// passwords when logging in
+type totpConfig struct {
+	SecretFile    string `yaml:"secretFile"`
+	SecretCommand string `yaml:"secretCommand"`
+}
+
+// browserConfig configures the browser used by the browser backend
+type browserConfig struct {
+	URL string `yaml:"url"`
+}
+
+// harvestConfig configures the Harvest API backend
+type harvestConfig struct {
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"apiKey"`
+}
+
+// historyConfig configures where the results of each run are stored, and for
+// how long they are kept
+type historyConfig struct {
+	Disabled bool   `yaml:"disabled"`
+	Dir      string `yaml:"dir"`
+	KeepDays int    `yaml:"keepDays"`
+	Daily    bool   `yaml:"daily"`
+}
+
+// serveConfig configures the HTTP server started by 'ghstat serve'
+type serveConfig struct {
+	Address  string        `yaml:"address"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// configPaths are the directories searched for a config file, in order
+var configPaths = []string{".", "$HOME/.config/ghstat"}
+
 // ParseConfig locates and parses the ghstat configuration
 func ParseConfig(configFile string) (*config, error) {
 	viper.SetConfigType("yaml")
+	viper.SetDefault("history.dir", history.DefaultDir())
+	viper.SetDefault("history.keepDays", 90)
+	viper.SetDefault("history.daily", true)
+	viper.SetDefault("serve.address", "localhost:8080")
+	viper.SetDefault("serve.interval", 15*time.Minute)
 
 	// If the user specified a path to the config file manually, load that file
 	if len(configFile) > 0 {
@@ -42,8 +138,9 @@ func ParseConfig(configFile string) (*config, error) {
 	} else {
 		// Otherwise check in the default locations
 		viper.SetConfigName("ghstat")
-		viper.AddConfigPath(".")
-		viper.AddConfigPath("$HOME/.config/ghstat")
+		for _, p := range configPaths {
+			viper.AddConfigPath(p)
+		}
 
 		err := viper.ReadInConfig()
 		if err != nil {
@@ -60,5 +157,64 @@ func ParseConfig(configFile string) (*config, error) {
 		return nil, errors.New("error parsing ghstat config file")
 	}
 
+	// Fall back to the built-in metrics if none are specified
+	if len(conf.Metrics) == 0 {
+		conf.Metrics = greenhouse.DefaultMetrics
+	}
+
+	err = greenhouse.ValidateMetrics(conf.Metrics)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metrics configuration: %w", err)
+	}
+
+	err = conf.Retry.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry configuration: %w", err)
+	}
+
 	return conf, nil
 }
+
+// filterLeads removes any leads not selected by the filter, if one was specified
+func (c *config) filterLeads() {
+	if len(c.Filter) > 0 {
+		c.Leads = slices.DeleteFunc(c.Leads, func(l lead) bool {
+			return !slices.Contains(c.Filter, l.Name)
+		})
+	}
+}
+
+// FindConfig returns the path of the config file that ParseConfig would load
+func FindConfig(configFile string) (string, error) {
+	if len(configFile) > 0 {
+		return configFile, nil
+	}
+
+	v := viper.New()
+	v.SetConfigName("ghstat")
+	for _, p := range configPaths {
+		v.AddConfigPath(p)
+	}
+
+	err := v.ReadInConfig()
+	if err != nil {
+		if errors.As(err, &viper.ConfigFileNotFoundError{}) {
+			return "", errors.New("no config file found, see 'ghstat --help' for details")
+		}
+		return "", errors.New("error parsing ghstat config file")
+	}
+
+	return v.ConfigFileUsed(), nil
+}
+
+// Hash returns a digest of the parts of the configuration which affect the
+// results of a run, such that results from different runs can be compared
+func (c *config) Hash() string {
+	buf, _ := json.Marshal(struct {
+		Leads   []lead
+		Metrics []greenhouse.Metric
+	}{c.Leads, c.Metrics})
+
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
@@ -3,22 +3,33 @@ package ghstat
 import (
 	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"sync/atomic"
+	"time"
 
 	"jnsgruk/ghstat/internal/formatters"
 	"jnsgruk/ghstat/internal/greenhouse"
+	"jnsgruk/ghstat/internal/history"
 	"jnsgruk/ghstat/internal/taskmaster"
 	"slices"
 
 	"golang.org/x/sync/errgroup"
 )
 
+// ErrIncompleteResults is returned in strict mode when any value could not be
+// retrieved from Greenhouse
+var ErrIncompleteResults = errors.New("some values could not be retrieved from greenhouse")
+
 // Manager is used for controlling the execution of the task workflow
 type Manager struct {
 	taskmaster *taskmaster.Taskmaster
 	roles      []*greenhouse.Role
+	lists      []*greenhouse.CandidateList
+	listMetric greenhouse.Metric
+	scrape     formatters.Scrape
 	config     *config
 	formatter  formatters.Formatter
 
@@ -27,13 +38,53 @@ type Manager struct {
 
 // NewManager constructs a new Manager, ensuring that a valid formatter has been chosen,
 // and ensures it has an associated Taskmaster instance
-func NewManager(config *config, greenhouse greenhouse.GreenhouseClient, writer io.Writer) (*Manager, error) {
-	formatter := formatters.NewFormatter(config.Formatter, writer)
+func NewManager(config *config, client greenhouse.GreenhouseClient, writer io.Writer) (*Manager, error) {
+	formatter := formatters.NewFormatter(config.Formatter, config.Metrics, writer)
+
+	// Templates are parsed up front, so that any errors are reported before
+	// scraping starts
+	if config.Formatter == "template" {
+		f, err := formatters.NewTemplateFormatter(config.Template, config.Metrics, writer)
+		if err != nil {
+			return nil, err
+		}
+		formatter = f
+	}
+
 	if formatter == nil {
-		return nil, fmt.Errorf("invalid output formatter specified, please choose one of 'pretty', 'markdown' or 'json'")
+		return nil, fmt.Errorf("invalid output formatter specified, please choose one of 'pretty', 'markdown', 'json', 'csv', 'tsv', 'html', 'openmetrics' or 'template'")
+	}
+
+	// Metric names are checked up front, so that a clash is reported before
+	// scraping starts
+	if _, ok := formatter.(*formatters.OpenMetricsFormatter); ok {
+		err := formatters.ValidateOpenMetrics(config.Metrics)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if f, ok := formatter.(formatters.HeaderFormatter); ok {
+		f.SetHeader(!config.NoHeader)
+	}
+
+	if f, ok := formatter.(formatters.LinkFormatter); ok {
+		baseUrl, err := greenhouse.ParseBaseURL(config.Greenhouse.URL)
+		if err != nil {
+			return nil, err
+		}
+		f.SetBaseURL(baseUrl)
+	}
+
+	if _, ok := formatter.(formatters.DiffFormatter); config.Diff && !ok {
+		return nil, fmt.Errorf("output formatter '%s' does not support showing changes", config.Formatter)
+	}
+
+	if _, ok := formatter.(formatters.CandidateFormatter); len(config.List) > 0 && !ok {
+		return nil, fmt.Errorf("output formatter '%s' does not support listing candidates", config.Formatter)
 	}
 
-	taskmaster, err := taskmaster.NewTaskmaster(config.Verbose)
+	taskmaster, err := taskmaster.NewTaskmaster(config.Verbose, !config.NonInteractive)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't create taskmaster: %w", err)
 	}
@@ -41,27 +92,61 @@ func NewManager(config *config, greenhouse greenhouse.GreenhouseClient, writer i
 	m := &Manager{
 		formatter:  formatter,
 		taskmaster: taskmaster,
-		greenhouse: greenhouse,
+		greenhouse: newReauthClient(client),
 		config:     config,
 	}
 
+	if len(config.List) > 0 {
+		found := false
+		for _, metric := range config.Metrics {
+			if metric.Key == config.List {
+				m.listMetric, found = metric, true
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown metric '%s' to list candidates for", config.List)
+		}
+	}
+
 	return m, nil
 }
 
-// Execute is the main entrypoint into the ghstat manager
-func (m *Manager) Execute() error {
+// Execute is the main entrypoint into the ghstat manager. Cancelling the
+// context stops any in-flight work and fails the running task. The Greenhouse
+// client is always closed once execution finishes, including on error or panic.
+func (m *Manager) Execute(ctx context.Context) error {
+	defer m.close()
+
 	m.taskmaster.AddTask(taskmaster.NewTask("login", "Logging in", m.login, false))
+
+	// Listing candidates replaces gathering statistics for the roles
+	if len(m.config.List) > 0 {
+		m.taskmaster.AddTask(taskmaster.NewTask("listing", "Listing candidates", m.list, false))
+		m.taskmaster.AddTask(taskmaster.NewTask("output", "Output", m.outputCandidates, true))
+		return m.taskmaster.Execute(ctx)
+	}
+
 	m.taskmaster.AddTask(taskmaster.NewTask("processing", "Processing roles", m.process, false))
 	m.taskmaster.AddTask(taskmaster.NewTask("output", "Output", m.output, true))
 
-	return m.taskmaster.Execute()
+	if m.historyEnabled() {
+		m.taskmaster.AddTask(taskmaster.NewTask("history", "Saving history", m.saveHistory, true))
+	}
+
+	err := m.taskmaster.Execute(ctx)
+	if err != nil {
+		return err
+	}
+
+	return m.reportFailures()
 }
 
 // login checks if the app is logged into Greenhouse from the cookies
 // created before, and if not walks the user through the checkLoggedIn flow by prompting
 // for their username, password and OTP
 func (m *Manager) login(tc *taskmaster.TaskCtl) error {
-	err := m.greenhouse.Login()
+	err := m.greenhouse.Login(tc.Context())
 	if err != nil {
 		return fmt.Errorf("failed to login to Greenhouse: %w", err)
 	}
@@ -70,26 +155,16 @@ func (m *Manager) login(tc *taskmaster.TaskCtl) error {
 
 // process iterates over the configured roles and gathers statistics about them
 func (m *Manager) process(tc *taskmaster.TaskCtl) error {
-	// Filter the leads where a filter was specified
-	if len(m.config.Filter) > 0 {
-		m.config.Leads = slices.DeleteFunc(m.config.Leads, func(l lead) bool {
-			return !slices.Contains(m.config.Filter, l.Name)
-		})
-	}
+	start := time.Now()
 
-	// Iterate over the list of leads/roles and construct new Role's for them
-	for _, lead := range m.config.Leads {
-		for _, roleId := range lead.Roles {
-			role := greenhouse.NewRole(roleId, lead.Name)
-			m.roles = append(m.roles, role)
-		}
-	}
+	m.config.filterLeads()
+	m.roles = newRoles(m.config)
 
 	// Update the spinner message to include the number of roles to process
 	tc.SetMessage(fmt.Sprintf("Processing %d roles", len(m.roles)))
 
 	// Calculate the number of fields that need fetching from Greenhouse
-	totalFields := len(m.roles) * greenhouse.NumRoleFields
+	totalFields := len(m.roles) * greenhouse.NumRoleFields(m.config.Metrics)
 	var fetchedFields atomic.Int64
 
 	// Helper method so that individual Role populate funcs can report back
@@ -99,42 +174,251 @@ func (m *Manager) process(tc *taskmaster.TaskCtl) error {
 		tc.SetProgress(float64(fetchedFields.Load()) / float64(totalFields) * 100)
 	}
 
+	err := populateRoles(tc.Context(), m.greenhouse, m.roles, incProgress)
+	if err != nil {
+		return err
+	}
+
+	m.scrape = formatters.NewScrape(m.roles, time.Since(start))
+	return nil
+}
+
+// newRoles constructs a Role for each of the roles of the configured leads
+func newRoles(conf *config) []*greenhouse.Role {
+	roles := []*greenhouse.Role{}
+
+	// Iterate over the list of leads/roles and construct new Role's for them
+	for _, lead := range conf.Leads {
+		for _, roleId := range lead.Roles {
+			role := greenhouse.NewRole(roleId, lead.Name, conf.Metrics)
+			role.Retry = conf.Retry
+			roles = append(roles, role)
+		}
+	}
+
+	return roles
+}
+
+// populateRoles gathers statistics about each of the roles concurrently
+func populateRoles(ctx context.Context, gh greenhouse.GreenhouseClient, roles []*greenhouse.Role, incProgress func(amount int64)) error {
 	// Create an error group to support concurrent processing of roles.
 	// Set a limit of 5 concurrent roles to process at max to avoid starving
 	// the machine of resources.
-	ctx := context.Background()
-	eg, _ := errgroup.WithContext(ctx)
+	// The group's context is cancelled if the task is cancelled, or if any of
+	// the roles fail to populate.
+	eg, ctx := errgroup.WithContext(ctx)
 	eg.SetLimit(5)
 
 	// Iterate over the roles, process each in its own goroutine.
-	for _, r := range m.roles {
-		r := r
-		eg.Go(func() error {
-			err := r.Populate(m.greenhouse, incProgress)
-			return err
+	for _, r := range roles {
+		eg.Go(func() (err error) {
+			// Panics in this goroutine can't be recovered by the caller, so
+			// report them as errors to ensure that the client is cleaned up.
+			defer func() {
+				if p := recover(); p != nil {
+					err = fmt.Errorf("panic while processing role %d: %v", r.ID, p)
+				}
+			}()
+			return r.Populate(ctx, gh, incProgress)
 		})
 	}
 
-	if err := eg.Wait(); err != nil {
-		return err
+	return eg.Wait()
+}
+
+// list gathers the candidates behind the selected metric for each of the
+// configured roles, or for a single role if one was specified
+func (m *Manager) list(tc *taskmaster.TaskCtl) error {
+	m.config.filterLeads()
+
+	for _, lead := range m.config.Leads {
+		for _, roleId := range lead.Roles {
+			if m.config.ListRole == 0 || m.config.ListRole == roleId {
+				l := greenhouse.NewCandidateList(roleId, lead.Name, m.listMetric)
+				l.Retry = m.config.Retry
+				m.lists = append(m.lists, l)
+			}
+		}
+	}
+
+	// A role which isn't in the config can still be listed, without a lead
+	if m.config.ListRole != 0 && len(m.lists) == 0 {
+		l := greenhouse.NewCandidateList(m.config.ListRole, "", m.listMetric)
+		l.Retry = m.config.Retry
+		m.lists = append(m.lists, l)
+	}
+
+	tc.SetMessage(fmt.Sprintf("Listing candidates for %d roles", len(m.lists)))
+
+	var listed atomic.Int64
+
+	eg, ctx := errgroup.WithContext(tc.Context())
+	eg.SetLimit(5)
+
+	for _, l := range m.lists {
+		eg.Go(func() (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = fmt.Errorf("panic while listing candidates for role %d: %v", l.RoleID, p)
+				}
+			}()
+
+			err = l.Populate(ctx, m.greenhouse)
+			if err != nil {
+				return err
+			}
+
+			tc.SetProgress(float64(listed.Add(1)) / float64(len(m.lists)) * 100)
+			return nil
+		})
 	}
 
+	return eg.Wait()
+}
+
+// outputCandidates uses the selected formatter to print the candidates listed
+// for each role
+func (m *Manager) outputCandidates(tc *taskmaster.TaskCtl) error {
+	slices.SortFunc(m.lists, func(a, b *greenhouse.CandidateList) int {
+		return cmp.Or(cmp.Compare(a.Lead, b.Lead), cmp.Compare(a.RoleID, b.RoleID))
+	})
+
+	if len(m.lists) == 0 {
+		return nil
+	}
+
+	m.formatter.(formatters.CandidateFormatter).OutputCandidates(m.lists)
 	return nil
 }
 
 // output uses the selected formatter to print the results to the terminal
 func (m *Manager) output(tc *taskmaster.TaskCtl) error {
-	// Sort the roles in ascending order by lead, then descending by number
-	// of outstanding app reviews
-	slices.SortFunc(m.roles, func(a, b *greenhouse.Role) int {
-		return cmp.Or(
-			cmp.Compare(a.Lead, b.Lead),
-			cmp.Compare(b.AppReviews(), a.AppReviews()),
-		)
+	sortRoles(m.roles, m.config.Metrics)
+
+	if len(m.roles) == 0 {
+		return nil
+	}
+
+	if m.config.Diff {
+		return m.outputDiff()
+	}
+
+	if f, ok := m.formatter.(formatters.ScrapeFormatter); ok {
+		f.SetScrape(m.scrape)
+	}
+
+	m.formatter.Output(m.roles)
+	return nil
+}
+
+// sortRoles sorts roles in ascending order by lead, then descending by the
+// value of the first of the metrics
+func sortRoles(roles []*greenhouse.Role, metrics []greenhouse.Metric) {
+	slices.SortFunc(roles, func(a, b *greenhouse.Role) int {
+		c := cmp.Compare(a.Lead, b.Lead)
+		if len(metrics) > 0 {
+			key := metrics[0].Key
+			c = cmp.Or(c, cmp.Compare(b.Value(key), a.Value(key)))
+		}
+		return c
 	})
+}
+
+// outputDiff uses the selected formatter to print the changes in the results
+// since the run selected from the history store
+func (m *Manager) outputDiff() error {
+	if len(m.config.History.Dir) == 0 {
+		return errors.New("no history directory configured")
+	}
+
+	since, err := history.ParseSince(m.config.Since, time.Now())
+	if err != nil {
+		return err
+	}
+
+	base, err := history.NewStore(m.config.History.Dir).At(since)
+	if err != nil {
+		if errors.Is(err, history.ErrNoSnapshot) {
+			return fmt.Errorf("no previous run found to compare against")
+		}
+		return fmt.Errorf("failed to read history: %w", err)
+	}
+
+	if base.ConfigHash != m.config.Hash() {
+		slog.Warn("comparing against a run with a different configuration", "timestamp", base.Timestamp)
+	}
+
+	m.formatter.(formatters.DiffFormatter).OutputDiff(history.Compare(base, m.roles))
+	return nil
+}
+
+// saveHistory persists a snapshot of the results to the history store, and
+// prunes old snapshots according to the configured retention policy
+func (m *Manager) saveHistory(tc *taskmaster.TaskCtl) error {
+	store := history.NewStore(m.config.History.Dir)
+
+	err := store.Save(history.NewSnapshot(m.roles, m.config.Hash()))
+	if err != nil {
+		return fmt.Errorf("failed to save results to history: %w", err)
+	}
+
+	policy := history.RetentionPolicy{
+		KeepDays: m.config.History.KeepDays,
+		Daily:    m.config.History.Daily,
+	}
+
+	removed, err := store.Prune(policy, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to prune history: %w", err)
+	}
+	slog.Debug("saved results to history", "dir", m.config.History.Dir, "pruned", removed)
+
+	return nil
+}
+
+// reportFailures logs a warning for each value that could not be retrieved,
+// and fails the run if strict mode is enabled. The number of retries made is
+// logged at debug level.
+func (m *Manager) reportFailures() error {
+	failures, retries := 0, 0
 
-	if len(m.roles) > 0 {
-		m.formatter.Output(m.roles)
+	for _, r := range m.roles {
+		for _, e := range r.Errors() {
+			slog.Warn("failed to retrieve value", "role", r.ID, "lead", r.Lead, "field", e.Field, "kind", e.Kind, "error", e.Error)
+			failures++
+		}
+
+		for field, n := range r.Retries() {
+			slog.Debug("retried value", "role", r.ID, "lead", r.Lead, "field", field, "retries", n)
+			retries += n
+		}
+	}
+
+	if retries > 0 {
+		slog.Debug("retried failed fetches", "retries", retries)
+	}
+
+	if failures == 0 {
+		return nil
+	}
+
+	slog.Warn("some values could not be retrieved and are shown as '?'", "failures", failures)
+
+	if m.config.Strict {
+		return ErrIncompleteResults
 	}
 	return nil
 }
+
+// close shuts down the Greenhouse client
+func (m *Manager) close() {
+	err := m.greenhouse.Close()
+	if err != nil {
+		slog.Warn("failed to close greenhouse client", "error", err.Error())
+	}
+}
+
+// historyEnabled reports whether the results of the run should be saved
+func (m *Manager) historyEnabled() bool {
+	return !m.config.History.Disabled && len(m.config.History.Dir) > 0
+}
@@ -2,10 +2,20 @@ package ghstat
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"jnsgruk/ghstat/internal/formatters"
+	"jnsgruk/ghstat/internal/greenhouse"
+	"jnsgruk/ghstat/internal/history"
 	"jnsgruk/ghstat/internal/taskmaster"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewManagerSuccess(t *testing.T) {
@@ -41,7 +51,7 @@ func TestManagerTasksNoRoles(t *testing.T) {
 		t.Fatalf("failed to get a manager instance: %s", err.Error())
 	}
 
-	err = m.Execute()
+	err = m.Execute(context.Background())
 	if err != nil {
 		t.Fatalf("failed to execute manager's tasks: %s", err.Error())
 	}
@@ -70,7 +80,7 @@ func TestManagerTasksNumRolesProcessed(t *testing.T) {
 		Roles: []int64{123, 456, 789},
 	}}
 
-	err := m.Execute()
+	err := m.Execute(context.Background())
 	if err != nil {
 		t.Errorf("error executing the manager: %s", err.Error())
 	}
@@ -88,7 +98,7 @@ func TestManagerTasksFormatterOutputWriter(t *testing.T) {
 		Roles: []int64{123, 456, 789},
 	}}
 
-	err := m.Execute()
+	err := m.Execute(context.Background())
 	if err != nil {
 		t.Errorf("error executing the manager: %s", err.Error())
 	}
@@ -105,9 +115,556 @@ func TestManagerTasksFormatterOutputWriter(t *testing.T) {
 	}
 }
 
+func TestManagerOpenMetricsOutput(t *testing.T) {
+	m, b, _ := testManager()
+
+	m.config.Leads = []lead{{
+		Name:  "Joe \"JB\" Bloggs",
+		Roles: []int64{123},
+	}}
+	m.config.Metrics = []greenhouse.Metric{
+		{Key: "appReviews", Description: "Outstanding application reviews", Query: greenhouse.FilterSet{"in_stages[]": "Application Review"}},
+		{Key: "offers", Query: greenhouse.FilterSet{"in_stages[]": "Offer"}},
+	}
+	m.formatter = formatters.NewFormatter("openmetrics", m.config.Metrics, b)
+
+	err := m.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("error executing the manager: %s", err.Error())
+	}
+
+	expected := `# TYPE ghstat_app_reviews gauge
+# HELP ghstat_app_reviews Outstanding application reviews
+ghstat_app_reviews{lead="Joe \"JB\" Bloggs",role_id="123",role_title="Role 123"} 17
+# TYPE ghstat_offers gauge
+ghstat_offers{lead="Joe \"JB\" Bloggs",role_id="123",role_title="Role 123"} 17
+# TYPE ghstat_scrape_duration_seconds gauge
+# HELP ghstat_scrape_duration_seconds How long it took to gather the statistics from Greenhouse
+`
+
+	if !strings.HasPrefix(b.String(), expected) {
+		t.Errorf("openmetrics output did not match expected output, got:\n%s", b.String())
+	}
+
+	if !strings.HasSuffix(b.String(), "ghstat_scrape_errors 0\n# EOF\n") {
+		t.Errorf("expected openmetrics output to report no scrape errors, got:\n%s", b.String())
+	}
+}
+
+func TestManagerOpenMetricsNameClash(t *testing.T) {
+	for name, keys := range map[string][]string{
+		"snake case":        {"appReviews", "app_reviews"},
+		"reserved":          {"scrapeErrors"},
+		"reserved duration": {"scrapeDurationSeconds"},
+	} {
+		config := &config{Formatter: "openmetrics"}
+		for _, key := range keys {
+			config.Metrics = append(config.Metrics, greenhouse.Metric{Key: key, Query: greenhouse.FilterSet{"in_stages[]": "Offer"}})
+		}
+
+		_, err := NewManager(config, &FakeGreenhouse{}, &bytes.Buffer{})
+		if err == nil {
+			t.Errorf("%s: expected metric keys %v to be rejected for openmetrics output", name, keys)
+		}
+	}
+}
+
+func TestManagerDelimitedOutput(t *testing.T) {
+	for _, tc := range []struct {
+		formatter string
+		noHeader  bool
+		expected  string
+	}{
+		{"csv", false, "Lead,Role,Offers,stale\n\"Bloggs, Joe \"\"JB\"\"\",Role 123,17,17\n\"Bloggs, Joe \"\"JB\"\"\",\"Engineer, \"\"Platform\"\"\",17,17\n"},
+		{"csv", true, "\"Bloggs, Joe \"\"JB\"\"\",Role 123,17,17\n\"Bloggs, Joe \"\"JB\"\"\",\"Engineer, \"\"Platform\"\"\",17,17\n"},
+		{"tsv", false, "Lead\tRole\tOffers\tstale\n\"Bloggs, Joe \"\"JB\"\"\"\tRole 123\t17\t17\n\"Bloggs, Joe \"\"JB\"\"\"\t\"Engineer, \"\"Platform\"\"\"\t17\t17\n"},
+	} {
+		m, b, _ := testManager()
+
+		m.config.Leads = []lead{{
+			Name:  `Bloggs, Joe "JB"`,
+			Roles: []int64{123, platformRoleId},
+		}}
+		m.config.Metrics = []greenhouse.Metric{
+			{Key: "offers", Label: "Offers", Query: greenhouse.FilterSet{"in_stages[]": "Offer"}},
+			{Key: "stale", Query: greenhouse.FilterSet{"last_activity_end": "2024/01/01"}},
+		}
+		m.config.NoHeader = tc.noHeader
+		m.config.Formatter = tc.formatter
+
+		m, err := NewManager(m.config, &FakeGreenhouse{}, b)
+		if err != nil {
+			t.Fatalf("failed to construct manager: %s", err.Error())
+		}
+
+		err = m.Execute(context.Background())
+		if err != nil {
+			t.Fatalf("error executing the manager: %s", err.Error())
+		}
+
+		if b.String() != tc.expected {
+			t.Errorf("%s output (no header: %t) did not match expected output, got:\n%s", tc.formatter, tc.noHeader, b.String())
+		}
+	}
+}
+
+func TestManagerHTMLOutput(t *testing.T) {
+	m, b, _ := testManager()
+
+	m.config.Leads = []lead{
+		{Name: "Joe Bloggs", Roles: []int64{123}},
+		{Name: "A.N. Other", Roles: []int64{456}},
+	}
+	m.config.Metrics = []greenhouse.Metric{
+		{Key: "offers", Label: "Offers", Query: greenhouse.FilterSet{"in_stages[]": "Offer"}, Thresholds: greenhouse.Thresholds{Warning: 10, Critical: 20}},
+		{Key: "stale", Query: greenhouse.FilterSet{"last_activity_end": "2024/01/01"}, Thresholds: greenhouse.Thresholds{Critical: 15}},
+	}
+	m.config.Greenhouse.URL = "https://example.greenhouse.io"
+	m.config.Formatter = "html"
+
+	m, err := NewManager(m.config, &FakeGreenhouse{}, b)
+	if err != nil {
+		t.Fatalf("failed to construct manager: %s", err.Error())
+	}
+
+	err = m.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("error executing the manager: %s", err.Error())
+	}
+
+	for _, s := range []string{
+		"<h2>A.N. Other</h2>",
+		"<h2>Joe Bloggs</h2>",
+		`<table class="sortable">`,
+		`<tr class="critical">`,
+		`<a href="https://example.greenhouse.io/plans/123/candidates?hiring_plan_id%5B%5D=123&amp;job_status=open&amp;stage_status_id%5B%5D=2&amp;type=all">Role 123</a>`,
+		`<td class="value warning" data-sort="17"><a href="https://example.greenhouse.io/plans/456/candidates?hiring_plan_id%5B%5D=456&amp;in_stages%5B%5D=Offer&amp;job_status=open&amp;stage_status_id%5B%5D=2&amp;type=all">17</a></td>`,
+		`<td class="value critical" data-sort="17">`,
+		"<style>",
+		"<script>",
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("expected html output to contain '%s', got:\n%s", s, b.String())
+		}
+	}
+
+	for _, s := range []string{`<link`, `src="http`} {
+		if strings.Contains(b.String(), s) {
+			t.Errorf("expected html output to be self-contained, found '%s'", s)
+		}
+	}
+}
+
+func TestManagerTemplateOutput(t *testing.T) {
+	for _, tc := range []struct {
+		file     string
+		template string
+		expected string
+	}{
+		{
+			"report.tmpl",
+			`{{ range .Leads }}{{ .Name }}: {{ sum "offers" .Roles }}{{ range sortBy "-id" .Roles }} {{ .ID }}={{ value . "offers" }}{{ end }}
+{{ end }}{{ range groupBy "title" (sortBy "id" .Roles) }}{{ .Name }} {{ end }}{{ .Totals.offers }} {{ .Run.Errors }} {{ greenhouseURL (index (sortBy "-id" .Roles) 0) "offers" }}`,
+			"<Bloggs>: 34 2=17 1=17\nA.N. Other: 17 3=17\nRole 1 Role 2 Role 3 51 0 https://example.greenhouse.io/plans/3/candidates?hiring_plan_id%5B%5D=3&in_stages%5B%5D=Offer&job_status=open&stage_status_id%5B%5D=2&type=all",
+		},
+		{
+			"report.html",
+			`{{ range .Leads }}<h2>{{ .Name }}</h2>{{ end }}`,
+			"<h2>&lt;Bloggs&gt;</h2><h2>A.N. Other</h2>",
+		},
+		// Rendering stops at an unknown metric key, rather than showing zeroes
+		{"sum.tmpl", `total: {{ sum "ofers" .Roles }}`, "total: "},
+		{"sort.tmpl", `roles:{{ range sortBy "-ofers" .Roles }} {{ .ID }}{{ end }}`, "roles:"},
+	} {
+		path := filepath.Join(t.TempDir(), tc.file)
+		if err := os.WriteFile(path, []byte(tc.template), 0o644); err != nil {
+			t.Fatalf("failed to write template: %s", err.Error())
+		}
+
+		m, b, _ := testManager()
+
+		m.config.Leads = []lead{
+			{Name: "<Bloggs>", Roles: []int64{1, 2}},
+			{Name: "A.N. Other", Roles: []int64{3}},
+		}
+		m.config.Metrics = []greenhouse.Metric{
+			{Key: "offers", Label: "Offers", Query: greenhouse.FilterSet{"in_stages[]": "Offer"}},
+		}
+		m.config.Greenhouse.URL = "https://example.greenhouse.io"
+		m.config.Formatter = "template"
+		m.config.Template = path
+
+		m, err := NewManager(m.config, &FakeGreenhouse{}, b)
+		if err != nil {
+			t.Fatalf("failed to construct manager: %s", err.Error())
+		}
+
+		err = m.Execute(context.Background())
+		if err != nil {
+			t.Fatalf("error executing the manager: %s", err.Error())
+		}
+
+		if b.String() != tc.expected {
+			t.Errorf("%s output did not match expected output, got:\n%s", tc.file, b.String())
+		}
+	}
+}
+
+func TestManagerTemplateParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.tmpl")
+	if err := os.WriteFile(path, []byte("{{ range .Roles }}"), 0o644); err != nil {
+		t.Fatalf("failed to write template: %s", err.Error())
+	}
+
+	m, b, _ := testManager()
+	m.config.Formatter = "template"
+
+	for _, template := range []string{"", path, filepath.Join(t.TempDir(), "missing.tmpl")} {
+		m.config.Template = template
+
+		if _, err := NewManager(m.config, &FakeGreenhouse{}, b); err == nil {
+			t.Errorf("expected an error constructing a manager with template '%s'", template)
+		}
+	}
+}
+
+func TestManagerTasksCustomMetrics(t *testing.T) {
+	m, b, _ := testManager()
+
+	m.config.Leads = []lead{{
+		Name:  "Joe Bloggs",
+		Roles: []int64{123},
+	}}
+	m.config.Metrics = []greenhouse.Metric{
+		{Key: "offers", Label: "Offers", Query: greenhouse.FilterSet{"in_stages[]": "Offer"}},
+	}
+	m.formatter = formatters.NewFormatter("markdown", m.config.Metrics, b)
+
+	err := m.Execute(context.Background())
+	if err != nil {
+		t.Errorf("error executing the manager: %s", err.Error())
+	}
+
+	expectedOutput := `| Lead       | Role     | Offers |
+| ---------- | -------- | ------ |
+| Joe Bloggs | Role 123 | 17     |
+`
+
+	if expectedOutput != b.String() {
+		t.Errorf("formatter output did not match expected output, got:\n%s", b.String())
+	}
+}
+
+func TestManagerSavesHistory(t *testing.T) {
+	m, _, _ := testManager()
+
+	m.config.History.Dir = t.TempDir()
+	m.config.Leads = []lead{{
+		Name:  "Joe Bloggs",
+		Roles: []int64{123, 456},
+	}}
+
+	err := m.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("error executing the manager: %s", err.Error())
+	}
+
+	snap, err := history.NewStore(m.config.History.Dir).Latest()
+	if err != nil {
+		t.Fatalf("failed to fetch snapshot from history: %s", err.Error())
+	}
+
+	if snap.ConfigHash != m.config.Hash() || len(snap.Roles) != 2 {
+		t.Errorf("incorrect snapshot saved to history: %+v", snap)
+	}
+
+	if snap.Roles[0].Values["appReviews"] != 17 {
+		t.Errorf("incorrect metric values saved to history: %+v", snap.Roles[0].Values)
+	}
+}
+
+func TestManagerDiffOutput(t *testing.T) {
+	m, b, _ := testManager()
+
+	m.config.Diff = true
+	m.config.History.Dir = t.TempDir()
+	m.config.Leads = []lead{{
+		Name:  "Joe Bloggs",
+		Roles: []int64{123, 456},
+	}}
+
+	base := &history.Snapshot{
+		Timestamp:  time.Now().Add(-time.Hour),
+		ConfigHash: m.config.Hash(),
+		Roles: []history.RoleSnapshot{{
+			ID:     123,
+			Lead:   "Joe Bloggs",
+			Values: map[string]int{"appReviews": 20, "needsDecision": 10, "needsScheduling": 17, "wiScreening": 17, "wiGrading": 17, "stale": 17},
+		}},
+	}
+	history.NewStore(m.config.History.Dir).Save(base)
+
+	err := m.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("error executing the manager: %s", err.Error())
+	}
+
+	expectedOutput := fmt.Sprintf(`Changes since %s
+
+| Lead       | Role     | CVs       | Decisions | Scheduling | WI (Screen) | WI (Grade) | Stale    |
+| ---------- | -------- | --------- | --------- | ---------- | ----------- | ---------- | -------- |
+| Joe Bloggs | Role 123 | 17 (↓3)   | 17 (↑7)   | 17 (=)     | 17 (=)      | 17 (=)     | 17 (=)   |
+| Joe Bloggs | Role 456 | 17 (new)  | 17 (new)  | 17 (new)   | 17 (new)    | 17 (new)   | 17 (new) |
+`, base.Timestamp.Local().Format(time.DateTime))
+
+	if expectedOutput != b.String() {
+		t.Errorf("formatter output did not match expected output, got:\n%s", b.String())
+	}
+}
+
+func TestManagerDiffUnknownTitle(t *testing.T) {
+	m, b, _ := testManager()
+
+	m.greenhouse = &FailingGreenhouse{}
+	m.config.Diff = true
+	m.config.History.Dir = t.TempDir()
+	m.config.Leads = []lead{{Name: "Joe Bloggs", Roles: []int64{123}}}
+	m.config.Metrics = []greenhouse.Metric{{Key: "offers", Label: "Offers", Query: greenhouse.FilterSet{"in_stages[]": "Offer"}}}
+	m.formatter = formatters.NewFormatter("csv", m.config.Metrics, b)
+
+	base := &history.Snapshot{
+		Timestamp:  time.Now().Add(-time.Hour),
+		ConfigHash: m.config.Hash(),
+		Roles:      []history.RoleSnapshot{{ID: 123, Lead: "Joe Bloggs", Values: map[string]int{"offers": 3}}},
+	}
+	history.NewStore(m.config.History.Dir).Save(base)
+
+	err := m.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("error executing the manager: %s", err.Error())
+	}
+
+	if b.String() != "Lead,Role,Offers\nJoe Bloggs,?,?\n" {
+		t.Errorf("expected a placeholder for the unknown title, got:\n%s", b.String())
+	}
+}
+
+func TestManagerDiffNoHistory(t *testing.T) {
+	m, _, _ := testManager()
+
+	m.config.Diff = true
+	m.config.History.Dir = t.TempDir()
+	m.config.Leads = []lead{{
+		Name:  "Joe Bloggs",
+		Roles: []int64{123},
+	}}
+
+	err := m.Execute(context.Background())
+	if err == nil {
+		t.Errorf("expected an error showing changes with no previous runs")
+	}
+}
+
+func TestManagerCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	m, _, _ := testManager()
+	m.greenhouse = &CancellingGreenhouse{cancel: cancel}
+	m.config.Leads = []lead{{
+		Name:  "Joe Bloggs",
+		Roles: []int64{123, 456},
+	}}
+
+	err := m.Execute(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected manager execution to be cancelled, got: %v", err)
+	}
+
+	for _, task := range m.taskmaster.Tasks() {
+		if task.Name == "processing" && (task.Status != taskmaster.Failed || !errors.Is(task.Error, context.Canceled)) {
+			t.Errorf("expected processing task to fail with a cancellation, got %s: %v", task.Status.String(), task.Error)
+		}
+
+		if task.Name == "output" && task.Status != taskmaster.Ready {
+			t.Errorf("expected output task not to run after cancellation, got %s", task.Status.String())
+		}
+	}
+}
+
+func TestManagerClosesClient(t *testing.T) {
+	tests := map[string]greenhouse.GreenhouseClient{
+		"success":       &FakeGreenhouse{},
+		"login failure": &FailingLoginGreenhouse{},
+		"worker panic":  &PanickingGreenhouse{},
+	}
+
+	for name, gh := range tests {
+		m, _, _ := testManager()
+		m.greenhouse = gh
+		m.config.Leads = []lead{{
+			Name:  "Joe Bloggs",
+			Roles: []int64{123, 456},
+		}}
+
+		m.Execute(context.Background())
+
+		if closed := closeCount(gh); closed != 1 {
+			t.Errorf("expected client to be closed once on %s, got %d", name, closed)
+		}
+	}
+}
+
+func TestManagerClosesClientOnPanic(t *testing.T) {
+	gh := &PanickingGreenhouse{loginPanics: true}
+
+	m, _, _ := testManager()
+	m.greenhouse = gh
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected manager execution to panic")
+		}
+
+		if gh.closed != 1 {
+			t.Errorf("expected client to be closed once after a panic, got %d", gh.closed)
+		}
+	}()
+
+	m.Execute(context.Background())
+}
+
+func TestManagerStrict(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		m, b, _ := testManager()
+		m.greenhouse = &FailingGreenhouse{}
+		m.config.Strict = strict
+		m.config.Leads = []lead{{
+			Name:  "Joe Bloggs",
+			Roles: []int64{123},
+		}}
+
+		err := m.Execute(context.Background())
+		if strict && !errors.Is(err, ErrIncompleteResults) {
+			t.Errorf("expected incomplete results error in strict mode, got: %v", err)
+		}
+
+		if !strict && err != nil {
+			t.Errorf("unexpected error with failures when not in strict mode: %s", err.Error())
+		}
+
+		expectedOutput := `| Lead       | Role | CVs | Decisions | Scheduling | WI (Screen) | WI (Grade) | Stale |
+| ---------- | ---- | --- | --------- | ---------- | ----------- | ---------- | ----- |
+| Joe Bloggs | ?    | ?   | ?         | ?          | ?           | ?          | ?     |
+`
+
+		if expectedOutput != b.String() {
+			t.Errorf("formatter output did not match expected output, got:\n%s", b.String())
+		}
+	}
+}
+
+func TestManagerListCandidates(t *testing.T) {
+	config := &config{
+		Leads:     []lead{{Name: "Joe Bloggs", Roles: []int64{123, 456}}},
+		Metrics:   greenhouse.DefaultMetrics,
+		Formatter: "json",
+		List:      "stale",
+		ListRole:  456,
+		// gospinner races with its own animation goroutine, so progress is
+		// logged instead
+		NonInteractive: true,
+	}
+
+	var b bytes.Buffer
+	m, err := NewManager(config, &FakeGreenhouse{}, &b)
+	if err != nil {
+		t.Fatalf("failed to construct manager: %s", err.Error())
+	}
+
+	err = m.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("failed to execute manager's tasks: %s", err.Error())
+	}
+
+	lists := []greenhouse.CandidateList{}
+	if err := json.Unmarshal(b.Bytes(), &lists); err != nil {
+		t.Fatalf("failed to parse output: %s", err.Error())
+	}
+
+	if len(lists) != 1 || lists[0].RoleID != 456 || lists[0].Title != "Role 456" || lists[0].Metric != "stale" {
+		t.Fatalf("incorrect candidate lists output: %+v", lists)
+	}
+
+	if len(lists[0].Candidates) != 2 || lists[0].Candidates[0].Name != "Jane Doe" {
+		t.Errorf("incorrect candidates listed: %+v", lists[0].Candidates)
+	}
+
+	// Listing candidates shouldn't save any statistics to the history store
+	for _, task := range m.taskmaster.Tasks() {
+		if task.Name == "processing" || task.Name == "history" {
+			t.Errorf("unexpected task '%s' when listing candidates", task.Name)
+		}
+	}
+}
+
+func TestManagerListUnknownMetric(t *testing.T) {
+	config := &config{
+		Metrics:   greenhouse.DefaultMetrics,
+		Formatter: "markdown",
+		List:      "foobar",
+	}
+
+	_, err := NewManager(config, &FakeGreenhouse{}, os.Stdout)
+	if err == nil {
+		t.Errorf("expected an error listing candidates for an unknown metric")
+	}
+}
+
+func TestManagerSessionExpiry(t *testing.T) {
+	m, b, _ := testManager()
+	eg := &ExpiringGreenhouse{expireAfter: 5}
+	m.greenhouse = newReauthClient(eg)
+	m.config.Leads = []lead{{Name: "Joe Bloggs", Roles: []int64{123, 456, 789}}}
+
+	err := m.Execute(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error when the session expired: %s", err.Error())
+	}
+
+	if eg.logins != 2 {
+		t.Errorf("expected to log in again once, logged in %d times", eg.logins)
+	}
+
+	// Every value should have been retrieved, despite the session expiring
+	if strings.Contains(b.String(), "?") {
+		t.Errorf("expected every value to be retrieved, got:\n%s", b.String())
+	}
+}
+
+func TestManagerSessionExpiryLoginFails(t *testing.T) {
+	for name, eg := range map[string]*ExpiringGreenhouse{
+		"login fails":   {expireAfter: 5, failLogin: true},
+		"expires again": {expireAfter: 5, expireAgain: true},
+	} {
+		m, _, _ := testManager()
+		m.greenhouse = newReauthClient(eg)
+		m.config.Leads = []lead{{Name: "Joe Bloggs", Roles: []int64{123, 456, 789}}}
+
+		err := m.Execute(context.Background())
+		if !errors.Is(err, greenhouse.ErrSessionExpired) {
+			t.Errorf("expected the run to fail when %s, got %v", name, err)
+		}
+
+		if eg.logins != 2 {
+			t.Errorf("expected to try logging in again once when %s, logged in %d times", name, eg.logins)
+		}
+	}
+}
+
 func testManager() (*Manager, *bytes.Buffer, error) {
 	config := &config{
 		Leads:     []lead{},
+		Metrics:   greenhouse.DefaultMetrics,
 		Verbose:   true,
 		Filter:    []string{},
 		Formatter: "markdown",
@@ -119,16 +676,161 @@ func testManager() (*Manager, *bytes.Buffer, error) {
 	return m, &b, err
 }
 
-type FakeGreenhouse struct{}
+type FakeGreenhouse struct {
+	closed int
+}
 
-func (fg *FakeGreenhouse) RoleTitle(roleId int64) (string, error) {
+// platformRoleId is the ID of a role with a title which must be quoted in
+// delimited output
+const platformRoleId = 321
+
+func (fg *FakeGreenhouse) RoleTitle(ctx context.Context, roleId int64) (string, error) {
+	if roleId == platformRoleId {
+		return `Engineer, "Platform"`, nil
+	}
 	return fmt.Sprintf("Role %d", roleId), nil
 }
 
-func (fg *FakeGreenhouse) CandidateCount(roleId int64, query map[string]string) (int, error) {
+func (fg *FakeGreenhouse) CandidateCount(ctx context.Context, roleId int64, query greenhouse.Query) (int, error) {
 	return 17, nil
 }
 
-func (fg *FakeGreenhouse) Login() error {
+func (fg *FakeGreenhouse) Candidates(ctx context.Context, roleId int64, query greenhouse.Query) ([]greenhouse.Candidate, error) {
+	return []greenhouse.Candidate{
+		{ID: 1, Name: "Jane Doe", Stage: "Application Review", LastActivity: "2024-06-01", URL: "https://canonical.greenhouse.io/people/1"},
+		{ID: 2, Name: "John Smith", Stage: "Application Review", LastActivity: "2024-06-02", URL: "https://canonical.greenhouse.io/people/2"},
+	}, nil
+}
+
+func (fg *FakeGreenhouse) Login(ctx context.Context) error {
 	return nil
 }
+
+func (fg *FakeGreenhouse) Close() error {
+	fg.closed++
+	return nil
+}
+
+// CancellingGreenhouse cancels the run when asked for a candidate count, and
+// waits for the cancellation like a page load in progress would
+type CancellingGreenhouse struct {
+	FakeGreenhouse
+	cancel context.CancelFunc
+}
+
+func (cg *CancellingGreenhouse) CandidateCount(ctx context.Context, roleId int64, query greenhouse.Query) (int, error) {
+	cg.cancel()
+	<-ctx.Done()
+	return -1, ctx.Err()
+}
+
+// FailingLoginGreenhouse fails to login
+type FailingLoginGreenhouse struct {
+	FakeGreenhouse
+}
+
+func (fg *FailingLoginGreenhouse) Login(ctx context.Context) error {
+	return errors.New("login failed")
+}
+
+// PanickingGreenhouse panics when fetching candidate counts, and optionally
+// when logging in
+type PanickingGreenhouse struct {
+	FakeGreenhouse
+	loginPanics bool
+}
+
+func (pg *PanickingGreenhouse) Login(ctx context.Context) error {
+	if pg.loginPanics {
+		panic("login panicked")
+	}
+	return nil
+}
+
+func (pg *PanickingGreenhouse) CandidateCount(ctx context.Context, roleId int64, query greenhouse.Query) (int, error) {
+	panic("candidate count panicked")
+}
+
+// closeCount returns the number of times a fake client was closed
+func closeCount(gh greenhouse.GreenhouseClient) int {
+	switch fg := gh.(type) {
+	case *FakeGreenhouse:
+		return fg.closed
+	case *FailingLoginGreenhouse:
+		return fg.closed
+	case *PanickingGreenhouse:
+		return fg.closed
+	}
+	return -1
+}
+
+// ExpiringGreenhouse is a client whose session expires after a number of
+// requests, until it logs in again. It can fail to log in again, or have its
+// session expire again immediately.
+type ExpiringGreenhouse struct {
+	FakeGreenhouse
+	expireAfter int
+	failLogin   bool
+	expireAgain bool
+
+	mu       sync.Mutex
+	requests int
+	logins   int
+	expired  bool
+}
+
+func (eg *ExpiringGreenhouse) Login(ctx context.Context) error {
+	eg.mu.Lock()
+	defer eg.mu.Unlock()
+
+	eg.logins++
+	if eg.logins > 1 && eg.failLogin {
+		return errors.New("login failed")
+	}
+
+	eg.expired = eg.logins > 1 && eg.expireAgain
+	return nil
+}
+
+func (eg *ExpiringGreenhouse) RoleTitle(ctx context.Context, roleId int64) (string, error) {
+	if err := eg.request(); err != nil {
+		return "", err
+	}
+	return eg.FakeGreenhouse.RoleTitle(ctx, roleId)
+}
+
+func (eg *ExpiringGreenhouse) CandidateCount(ctx context.Context, roleId int64, query greenhouse.Query) (int, error) {
+	if err := eg.request(); err != nil {
+		return -1, err
+	}
+	return eg.FakeGreenhouse.CandidateCount(ctx, roleId, query)
+}
+
+// request counts a request, failing it if the session has expired
+func (eg *ExpiringGreenhouse) request() error {
+	eg.mu.Lock()
+	defer eg.mu.Unlock()
+
+	eg.requests++
+	if eg.requests == eg.expireAfter && eg.logins == 1 {
+		eg.expired = true
+	}
+
+	if eg.expired {
+		return fmt.Errorf("failed to retrieve candidate page: %w", greenhouse.ErrSessionExpired)
+	}
+	return nil
+}
+
+// FailingGreenhouse fails to retrieve any values
+type FailingGreenhouse struct {
+	FakeGreenhouse
+}
+
+func (fg *FailingGreenhouse) RoleTitle(ctx context.Context, roleId int64) (string, error) {
+	return "", errors.New("no title")
+}
+
+func (fg *FailingGreenhouse) CandidateCount(ctx context.Context, roleId int64, query greenhouse.Query) (int, error) {
+	return -1, errors.New("no results count")
+}
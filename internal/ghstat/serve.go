@@ -0,0 +1,126 @@
+package ghstat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"jnsgruk/ghstat/internal/formatters"
+	"jnsgruk/ghstat/internal/greenhouse"
+	"jnsgruk/ghstat/internal/server"
+)
+
+// Serve logs in to Greenhouse, then serves the statistics for the configured
+// roles over HTTP until the context is cancelled, refreshing them on the
+// configured interval with the same client. The client is always closed once
+// the server stops.
+func Serve(ctx context.Context, conf *config, gh greenhouse.GreenhouseClient) error {
+	defer func() {
+		err := gh.Close()
+		if err != nil {
+			slog.Warn("failed to close greenhouse client", "error", err.Error())
+		}
+	}()
+
+	if conf.Serve.Interval <= 0 {
+		return fmt.Errorf("invalid refresh interval '%s'", conf.Serve.Interval)
+	}
+
+	// The statistics are also served in the OpenMetrics format
+	err := formatters.ValidateOpenMetrics(conf.Metrics)
+	if err != nil {
+		return err
+	}
+
+	conf.filterLeads()
+
+	leads := []string{}
+	for _, l := range conf.Leads {
+		leads = append(leads, l.Name)
+	}
+
+	// Log in before listening, so that a missing session or credential is
+	// reported before the server starts
+	err = gh.Login(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to login to Greenhouse: %w", err)
+	}
+
+	srv := server.New(refresher(conf, gh), conf.Serve.Interval, conf.Metrics, leads)
+
+	ln, err := net.Listen("tcp", conf.Serve.Address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on '%s': %w", conf.Serve.Address, err)
+	}
+
+	httpSrv := &http.Server{Handler: srv.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- httpSrv.Serve(ln)
+	}()
+
+	slog.Info("serving role statistics", "address", ln.Addr().String(), "interval", conf.Serve.Interval)
+
+	// Stop refreshing, and wait for any refresh in progress to finish, before
+	// the client is closed
+	refreshCtx, stopRefresh := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.Run(refreshCtx)
+	}()
+	defer func() {
+		stopRefresh()
+		<-done
+	}()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = httpSrv.Shutdown(shutdownCtx)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
+
+	return nil
+}
+
+// refresher returns a function which gathers statistics for the configured
+// roles. Any data cached by the client is discarded, and the session is
+// checked, before each refresh. The session may be re-established once during
+// each refresh if it expires.
+func refresher(conf *config, gh greenhouse.GreenhouseClient) server.RefreshFunc {
+	return func(ctx context.Context) ([]*greenhouse.Role, error) {
+		if c, ok := gh.(greenhouse.CachingClient); ok {
+			c.Reset()
+		}
+
+		client := newReauthClient(gh)
+
+		err := client.Login(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to login to Greenhouse: %w", err)
+		}
+
+		roles := newRoles(conf)
+
+		err = populateRoles(ctx, client, roles, func(amount int64) {})
+		if err != nil {
+			return nil, err
+		}
+
+		sortRoles(roles, conf.Metrics)
+		return roles, nil
+	}
+}
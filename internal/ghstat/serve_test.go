@@ -0,0 +1,160 @@
+package ghstat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"jnsgruk/ghstat/internal/greenhouse"
+	"jnsgruk/ghstat/internal/server"
+)
+
+func TestServeLoginFails(t *testing.T) {
+	conf := &config{Serve: serveConfig{Address: "localhost:0", Interval: time.Minute}}
+	gh := &FailingLoginGreenhouse{}
+
+	err := Serve(context.Background(), conf, gh)
+	if err == nil {
+		t.Errorf("expected serving to fail when unable to log in")
+	}
+
+	if closeCount(gh) != 1 {
+		t.Errorf("expected greenhouse client to be closed once, closed %d times", closeCount(gh))
+	}
+}
+
+func TestServeStops(t *testing.T) {
+	conf := &config{
+		Leads:   []lead{{Name: "Joe Bloggs", Roles: []int64{123}}},
+		Serve:   serveConfig{Address: "localhost:0", Interval: time.Minute},
+		Metrics: greenhouse.DefaultMetrics,
+	}
+	gh := &FakeGreenhouse{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := Serve(ctx, conf, gh)
+	if err != nil {
+		t.Errorf("expected server to stop cleanly when cancelled, got %s", err.Error())
+	}
+
+	if closeCount(gh) != 1 {
+		t.Errorf("expected greenhouse client to be closed once, closed %d times", closeCount(gh))
+	}
+}
+
+func TestServeOpenMetricsNameClash(t *testing.T) {
+	conf := &config{
+		Leads:   []lead{{Name: "Joe Bloggs", Roles: []int64{123}}},
+		Serve:   serveConfig{Address: "localhost:0", Interval: time.Minute},
+		Metrics: []greenhouse.Metric{{Key: "scrapeErrors", Query: greenhouse.FilterSet{"in_stages[]": "Offer"}}},
+	}
+	gh := &FakeGreenhouse{}
+
+	err := Serve(context.Background(), conf, gh)
+	if err == nil {
+		t.Errorf("expected serving to fail with a metric named after a scrape gauge")
+	}
+
+	if closeCount(gh) != 1 {
+		t.Errorf("expected greenhouse client to be closed once, closed %d times", closeCount(gh))
+	}
+}
+
+func TestRefresher(t *testing.T) {
+	conf := &config{
+		Leads: []lead{
+			{Name: "Joe Bloggs", Roles: []int64{123, 456}},
+			{Name: "A.N. Other", Roles: []int64{789}},
+		},
+		Metrics: greenhouse.DefaultMetrics,
+	}
+
+	roles, err := refresher(conf, &FakeGreenhouse{})(context.Background())
+	if err != nil {
+		t.Fatalf("failed to refresh roles: %s", err.Error())
+	}
+
+	if len(roles) != 3 || roles[0].Lead != "A.N. Other" || roles[0].Title != "Role 789" {
+		t.Errorf("expected every role to be refreshed and sorted by lead")
+	}
+}
+
+func TestRefresherAuthRequired(t *testing.T) {
+	conf := &config{
+		Leads:   []lead{{Name: "Joe Bloggs", Roles: []int64{123}}},
+		Metrics: greenhouse.DefaultMetrics,
+	}
+
+	_, err := refresher(conf, &AuthRequiredGreenhouse{})(context.Background())
+
+	var authErr *greenhouse.AuthRequiredError
+	if !errors.As(err, &authErr) {
+		t.Errorf("expected refresh to report that authentication is required, got %v", err)
+	}
+}
+
+func TestServeRefreshesHarvest(t *testing.T) {
+	// held is the number of applications the stand-in Harvest API reports in
+	// the 'Hold' stage
+	var held atomic.Int64
+	held.Store(1)
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/jobs/123":
+			fmt.Fprint(w, `{"id": 123, "name": "Software Engineer"}`)
+		case "/v1/applications":
+			apps := []string{}
+			for i := range held.Load() {
+				apps = append(apps, fmt.Sprintf(`{"id": %d, "candidate_id": %d, "status": "active", "current_stage": {"id": 1, "name": "Hold"}}`, i, i))
+			}
+			fmt.Fprintf(w, "[%s]", strings.Join(apps, ","))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer api.Close()
+
+	conf := &config{
+		Leads:   []lead{{Name: "Joe Bloggs", Roles: []int64{123}}},
+		Metrics: []greenhouse.Metric{{Key: "held", Label: "Held", Query: greenhouse.FilterSet{"in_stages[]": "Hold"}}},
+	}
+	gh := greenhouse.NewHarvest(api.URL+"/v1", "secret", "")
+	srv := server.New(refresher(conf, gh), time.Minute, conf.Metrics, []string{"Joe Bloggs"})
+
+	for _, expected := range []int64{1, 3} {
+		held.Store(expected)
+		srv.Refresh(context.Background())
+
+		rec := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/roles", nil))
+
+		roles := []map[string]any{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &roles); err != nil {
+			t.Fatalf("failed to decode roles: %s", err.Error())
+		}
+
+		if len(roles) != 1 || roles[0]["held"] != float64(expected) {
+			t.Errorf("expected %d held candidates after refreshing, got %s", expected, rec.Body.String())
+		}
+	}
+}
+
+// AuthRequiredGreenhouse can't log in without prompting for a credential
+type AuthRequiredGreenhouse struct {
+	FakeGreenhouse
+}
+
+func (fg *AuthRequiredGreenhouse) Login(ctx context.Context) error {
+	_, err := greenhouse.NonInteractivePrompter{}.Prompt("Ubuntu One Password", true)
+	return fmt.Errorf("failed to log in: %w", err)
+}
@@ -0,0 +1,107 @@
+package ghstat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"jnsgruk/ghstat/internal/greenhouse"
+)
+
+// reauthClient wraps a GreenhouseClient, logging in again if the session expires
+// partway through a run. Requests are paused while logging in, and any which
+// failed because the session expired are retried once it is re-established.
+// The session is only re-established once per run.
+type reauthClient struct {
+	greenhouse.GreenhouseClient
+
+	// mu is held for reading by each request, and for writing while logging in,
+	// so that no requests are started or in flight while logging in
+	mu sync.RWMutex
+	// generation is incremented each time the session is re-established
+	generation int
+	// reauthenticated is set once the session has been re-established
+	reauthenticated bool
+}
+
+// newReauthClient wraps a client such that it logs in again if its session
+// expires
+func newReauthClient(gh greenhouse.GreenhouseClient) *reauthClient {
+	return &reauthClient{GreenhouseClient: gh}
+}
+
+// RoleTitle reports the title of the specified role
+func (c *reauthClient) RoleTitle(ctx context.Context, roleId int64) (title string, err error) {
+	err = c.do(ctx, func() error {
+		title, err = c.GreenhouseClient.RoleTitle(ctx, roleId)
+		return err
+	})
+	return title, err
+}
+
+// CandidateCount reports the number of candidates for a role matching a query
+func (c *reauthClient) CandidateCount(ctx context.Context, roleId int64, query greenhouse.Query) (count int, err error) {
+	err = c.do(ctx, func() error {
+		count, err = c.GreenhouseClient.CandidateCount(ctx, roleId, query)
+		return err
+	})
+	return count, err
+}
+
+// Candidates lists the candidates for a role matching a query
+func (c *reauthClient) Candidates(ctx context.Context, roleId int64, query greenhouse.Query) (candidates []greenhouse.Candidate, err error) {
+	err = c.do(ctx, func() error {
+		candidates, err = c.GreenhouseClient.Candidates(ctx, roleId, query)
+		return err
+	})
+	return candidates, err
+}
+
+// do runs a request, logging in again and retrying it if the session expired
+func (c *reauthClient) do(ctx context.Context, request func() error) error {
+	for {
+		c.mu.RLock()
+		generation := c.generation
+		err := request()
+		c.mu.RUnlock()
+
+		if !errors.Is(err, greenhouse.ErrSessionExpired) {
+			return err
+		}
+
+		err = c.reauthenticate(ctx, generation)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// reauthenticate logs in again, unless the session has been re-established
+// since the specified generation. Only one attempt is made to log in again.
+func (c *reauthClient) reauthenticate(ctx context.Context, generation int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Another request has already logged in again since this one was started
+	if c.generation != generation {
+		return nil
+	}
+
+	if c.reauthenticated {
+		return fmt.Errorf("%w again since logging in again", greenhouse.ErrSessionExpired)
+	}
+	c.reauthenticated = true
+
+	slog.Warn("greenhouse session expired, logging in again")
+
+	err := c.GreenhouseClient.Login(ctx)
+	if err != nil {
+		return fmt.Errorf("%w, and failed to log in again: %w", greenhouse.ErrSessionExpired, err)
+	}
+
+	c.generation++
+	slog.Debug("re-established greenhouse session")
+	return nil
+}
@@ -0,0 +1,303 @@
+package greenhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"jnsgruk/ghstat/internal/credentials"
+
+	"github.com/go-rod/rod"
+	"github.com/manifoldco/promptui"
+)
+
+// Login providers which can be selected to log in to Greenhouse
+const (
+	LoginProviderUbuntuOne  = "ubuntuone"
+	LoginProviderGreenhouse = "greenhouse"
+	LoginProviderNone       = "none"
+)
+
+// ErrNoSession is returned when there is no active Greenhouse session, and the
+// login provider is unable to create one
+var ErrNoSession = errors.New("no active greenhouse session")
+
+// ErrSessionExpired is returned when Greenhouse redirects to the login page
+// while fetching a page, because the session has expired since logging in
+var ErrSessionExpired = errors.New("greenhouse session has expired")
+
+// Prompter asks the user for a value, such as a login or password
+type Prompter interface {
+	Prompt(label string, secret bool) (string, error)
+}
+
+// TerminalPrompter prompts for values interactively on the terminal
+type TerminalPrompter struct{}
+
+// Prompt asks the user for a value on the terminal, masking the input if the
+// value is secret
+func (TerminalPrompter) Prompt(label string, secret bool) (string, error) {
+	prompt := promptui.Prompt{Label: label}
+	if secret {
+		prompt.Mask = '*'
+	}
+	return prompt.Run()
+}
+
+// Credential describes a credential used to log in, such as a login or password
+type Credential struct {
+	// Name identifies the credential in credential sources, such as the keyring
+	Name string
+	// Env is the environment variable from which the credential can be read
+	Env string
+	// Label is shown when prompting for the credential
+	Label string
+	// Secret is true if the credential should be masked when prompted for
+	Secret bool
+}
+
+// Credentials used by the login providers
+var (
+	ubuntuOneLogin     = Credential{Name: "ubuntuone/login", Env: "U1_LOGIN", Label: "Ubuntu One Login"}
+	ubuntuOnePassword  = Credential{Name: "ubuntuone/password", Env: "U1_PASSWORD", Label: "Ubuntu One Password", Secret: true}
+	greenhouseLogin    = Credential{Name: "greenhouse/login", Env: "GREENHOUSE_LOGIN", Label: "Greenhouse Email"}
+	greenhousePassword = Credential{Name: "greenhouse/password", Env: "GREENHOUSE_PASSWORD", Label: "Greenhouse Password", Secret: true}
+)
+
+// Credentials looks up the credentials used to log in from each of its sources
+// in turn, such as a credential command or the keyring, falling back to the
+// credential's environment variable, and finally to prompting for it
+type Credentials struct {
+	Sources  []credentials.Source
+	Prompter Prompter
+}
+
+// lookup reads a credential from the first source which has it. Sources which
+// fail are skipped, and their first error is only returned if the credential
+// can't be read from the environment or prompted for either
+func (c Credentials) lookup(ctx context.Context, cred Credential) (string, error) {
+	var sourceErr error
+	for _, source := range c.Sources {
+		value, err := source.Get(ctx, cred.Name)
+		if err == nil {
+			return value, nil
+		}
+
+		if !errors.Is(err, credentials.ErrNotFound) {
+			slog.Warn("failed to read credential from source", "credential", cred.Name, "error", err.Error())
+			if sourceErr == nil {
+				sourceErr = err
+			}
+		}
+	}
+
+	if value := os.Getenv(cred.Env); len(value) > 0 {
+		return value, nil
+	}
+
+	value, err := c.Prompter.Prompt(cred.Label, cred.Secret)
+	if err != nil {
+		return "", errors.Join(sourceErr, err)
+	}
+
+	return value, nil
+}
+
+// AuthRequiredError is returned when a credential is required to log in, but
+// ghstat is running non-interactively and can't prompt for it
+type AuthRequiredError struct {
+	Label string
+}
+
+func (e *AuthRequiredError) Error() string {
+	return fmt.Sprintf("authentication required, but unable to prompt for '%s' when running non-interactively", e.Label)
+}
+
+// NonInteractivePrompter fails every prompt with an AuthRequiredError, for use
+// when there is nobody to answer prompts, such as in CI or cron jobs
+type NonInteractivePrompter struct{}
+
+// Prompt returns an AuthRequiredError for the value being prompted for
+func (NonInteractivePrompter) Prompt(label string, secret bool) (string, error) {
+	return "", &AuthRequiredError{Label: label}
+}
+
+// Authenticator is an interface for strategies which log in to Greenhouse
+type Authenticator interface {
+	// LoginURLPatterns returns regular expressions matching the URL of the login
+	// page that Greenhouse redirects to when there is no active session
+	LoginURLPatterns() []string
+	// Credentials returns the credentials required to log in
+	Credentials() []Credential
+	// Authenticate completes the login flow on a page showing the login page,
+	// returning the name of the account that was logged in to
+	Authenticate(ctx context.Context, page *rod.Page) (string, error)
+}
+
+// NewAuthenticator constructs the Authenticator for a login provider, which
+// looks up any credentials that are required with creds, and generates
+// one-time passwords from the seed described by secret, if any
+func NewAuthenticator(provider string, creds Credentials, secret TOTPSecret) (Authenticator, error) {
+	if creds.Prompter == nil {
+		creds.Prompter = TerminalPrompter{}
+	}
+
+	switch provider {
+	case "", LoginProviderUbuntuOne:
+		return &UbuntuOneAuthenticator{creds: creds, secret: secret, now: time.Now}, nil
+	case LoginProviderGreenhouse:
+		return &PasswordAuthenticator{creds: creds}, nil
+	case LoginProviderNone:
+		return &NoopAuthenticator{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported login provider '%s', please choose one of '%s', '%s' or '%s'",
+			provider, LoginProviderUbuntuOne, LoginProviderGreenhouse, LoginProviderNone)
+	}
+}
+
+// UbuntuOneAuthenticator logs in to Greenhouse through the Ubuntu One SSO,
+// using a login, password and one-time password
+type UbuntuOneAuthenticator struct {
+	creds  Credentials
+	secret TOTPSecret
+	// now returns the time at which one-time passwords are generated
+	now func() time.Time
+}
+
+// LoginURLPatterns matches the Ubuntu One login page
+func (a *UbuntuOneAuthenticator) LoginURLPatterns() []string {
+	return []string{`^https://login\.ubuntu\.com/\+login`}
+}
+
+// Credentials returns the Ubuntu One login and password
+func (a *UbuntuOneAuthenticator) Credentials() []Credential {
+	return []Credential{ubuntuOneLogin, ubuntuOnePassword}
+}
+
+// Authenticate fills in the Ubuntu One login form, taking the login and password
+// from the configured credential sources, or the U1_LOGIN and U1_PASSWORD
+// environment variables if they are set, and then the one-time password form.
+// The one-time password is generated from the seed in U1_TOTP_SECRET, or the
+// configured TOTP secret, if available.
+func (a *UbuntuOneAuthenticator) Authenticate(ctx context.Context, page *rod.Page) (string, error) {
+	login, err := a.creds.lookup(ctx, ubuntuOneLogin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read login: %w", err)
+	}
+
+	password, err := a.creds.lookup(ctx, ubuntuOnePassword)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+
+	err = submitForm(page, map[string]string{"#id_email": login, "#id_password": password})
+	if err != nil {
+		return "", err
+	}
+
+	otp, err := a.secret.otp(ctx, "U1_TOTP_SECRET", a.now())
+	if err != nil {
+		return "", fmt.Errorf("failed to generate otp: %w", err)
+	}
+
+	if len(otp) == 0 {
+		otp, err = a.creds.Prompter.Prompt("Ubuntu One OTP", false)
+		if err != nil {
+			return "", fmt.Errorf("failed to read otp: %w", err)
+		}
+	}
+
+	return login, submitForm(page, map[string]string{"#id_oath_token": otp})
+}
+
+// PasswordAuthenticator logs in to Greenhouse directly, using a Greenhouse
+// email address and password
+type PasswordAuthenticator struct {
+	creds Credentials
+}
+
+// LoginURLPatterns matches the Greenhouse sign in page
+func (a *PasswordAuthenticator) LoginURLPatterns() []string {
+	return []string{`/users/sign_in`}
+}
+
+// Credentials returns the Greenhouse email address and password
+func (a *PasswordAuthenticator) Credentials() []Credential {
+	return []Credential{greenhouseLogin, greenhousePassword}
+}
+
+// Authenticate fills in the Greenhouse sign in form, taking the email address
+// and password from the configured credential sources, or the GREENHOUSE_LOGIN
+// and GREENHOUSE_PASSWORD environment variables if they are set
+func (a *PasswordAuthenticator) Authenticate(ctx context.Context, page *rod.Page) (string, error) {
+	login, err := a.creds.lookup(ctx, greenhouseLogin)
+	if err != nil {
+		return "", fmt.Errorf("failed to read login: %w", err)
+	}
+
+	password, err := a.creds.lookup(ctx, greenhousePassword)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+
+	// The email address and password may be asked for on separate pages
+	err = inputText(page, "#user_email", login)
+	if err != nil {
+		return "", err
+	}
+
+	if has, _, _ := page.Has("#user_password"); !has {
+		err = submitForm(page, map[string]string{})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return login, submitForm(page, map[string]string{"#user_password": password})
+}
+
+// NoopAuthenticator relies on the cookies saved by a previous session, and
+// fails if Greenhouse redirects to a login page
+type NoopAuthenticator struct{}
+
+// LoginURLPatterns returns no patterns, as there is no login page to detect
+// unless one is configured
+func (a *NoopAuthenticator) LoginURLPatterns() []string {
+	return []string{}
+}
+
+// Credentials returns no credentials, as none are used
+func (a *NoopAuthenticator) Credentials() []Credential {
+	return []Credential{}
+}
+
+// Authenticate reports that there is no active session
+func (a *NoopAuthenticator) Authenticate(ctx context.Context, page *rod.Page) (string, error) {
+	return "", fmt.Errorf("%w, and the login provider is '%s'", ErrNoSession, LoginProviderNone)
+}
+
+// submitForm types the specified values into the elements matching each
+// selector, then submits the form and waits for the next page to settle
+func submitForm(page *rod.Page, values map[string]string) error {
+	for selector, value := range values {
+		err := inputText(page, selector, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := clickElement(page, "[type=submit]")
+	if err != nil {
+		return err
+	}
+
+	err = page.WaitStable(300 * time.Millisecond)
+	if err != nil {
+		return fmt.Errorf("failed to check login status: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,358 @@
+package greenhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"jnsgruk/ghstat/internal/credentials"
+	"jnsgruk/ghstat/internal/credentials/credentialstest"
+	"jnsgruk/ghstat/internal/totp"
+)
+
+func TestNewAuthenticator(t *testing.T) {
+	for provider, expected := range map[string]string{
+		"":                      "*greenhouse.UbuntuOneAuthenticator",
+		LoginProviderUbuntuOne:  "*greenhouse.UbuntuOneAuthenticator",
+		LoginProviderGreenhouse: "*greenhouse.PasswordAuthenticator",
+		LoginProviderNone:       "*greenhouse.NoopAuthenticator",
+	} {
+		auth, err := NewAuthenticator(provider, Credentials{Prompter: &credentialstest.Prompter{}}, TOTPSecret{})
+		if err != nil {
+			t.Fatalf("failed to construct authenticator for provider '%s': %s", provider, err.Error())
+		}
+
+		if fmt.Sprintf("%T", auth) != expected {
+			t.Errorf("incorrect authenticator for provider '%s', expected %s, got %T", provider, expected, auth)
+		}
+	}
+
+	if _, err := NewAuthenticator("foobar", Credentials{}, TOTPSecret{}); err == nil {
+		t.Errorf("expected an error constructing an authenticator for an unknown provider")
+	}
+}
+
+func TestNoopAuthenticator(t *testing.T) {
+	_, err := (&NoopAuthenticator{}).Authenticate(context.Background(), nil)
+	if !errors.Is(err, ErrNoSession) {
+		t.Errorf("expected ErrNoSession from the no-op authenticator, got %v", err)
+	}
+}
+
+func TestCredentialsLookup(t *testing.T) {
+	cred := Credential{Name: "test/login", Env: "GHSTAT_TEST_LOGIN", Label: "Login"}
+	p := &credentialstest.Prompter{Values: map[string]string{"Login": "prompted"}}
+
+	creds := Credentials{
+		Sources:  []credentials.Source{FakeSource{}, FakeSource{"test/login": "from-source"}},
+		Prompter: p,
+	}
+
+	t.Setenv("GHSTAT_TEST_LOGIN", "from-env")
+	value, err := creds.lookup(context.Background(), cred)
+	if err != nil || value != "from-source" {
+		t.Errorf("expected credential to be read from a source, got '%s' (%v)", value, err)
+	}
+
+	creds.Sources = []credentials.Source{FakeSource{}}
+	value, err = creds.lookup(context.Background(), cred)
+	if err != nil || value != "from-env" {
+		t.Errorf("expected credential to be read from the environment, got '%s' (%v)", value, err)
+	}
+
+	t.Setenv("GHSTAT_TEST_LOGIN", "")
+	value, err = creds.lookup(context.Background(), cred)
+	if err != nil || value != "prompted" {
+		t.Errorf("expected credential to be prompted for, got '%s' (%v)", value, err)
+	}
+
+	if len(p.Asked) != 1 {
+		t.Errorf("expected to be prompted once, was prompted %d times", len(p.Asked))
+	}
+}
+
+func TestCredentialsLookupError(t *testing.T) {
+	t.Setenv("U1_LOGIN", "")
+
+	creds := Credentials{
+		Sources:  []credentials.Source{credentials.Command{Command: "echo"}, FailingSource{}},
+		Prompter: &credentialstest.Prompter{},
+	}
+
+	_, err := creds.lookup(context.Background(), ubuntuOneLogin)
+	if err == nil || !strings.Contains(err.Error(), "source unavailable") {
+		t.Errorf("expected an error from a failing credential source, got %v", err)
+	}
+}
+
+func TestCredentialsLookupFailingSourceSkipped(t *testing.T) {
+	cred := Credential{Name: "test/login", Env: "GHSTAT_TEST_LOGIN", Label: "Login"}
+	p := &credentialstest.Prompter{Values: map[string]string{"Login": "prompted"}}
+
+	creds := Credentials{
+		Sources:  []credentials.Source{FailingSource{}, FakeSource{"test/login": "from-source"}},
+		Prompter: p,
+	}
+
+	t.Setenv("GHSTAT_TEST_LOGIN", "from-env")
+	value, err := creds.lookup(context.Background(), cred)
+	if err != nil || value != "from-source" {
+		t.Errorf("expected credential to be read from the next source, got '%s' (%v)", value, err)
+	}
+
+	creds.Sources = []credentials.Source{FailingSource{}}
+	value, err = creds.lookup(context.Background(), cred)
+	if err != nil || value != "from-env" {
+		t.Errorf("expected credential to be read from the environment, got '%s' (%v)", value, err)
+	}
+
+	t.Setenv("GHSTAT_TEST_LOGIN", "")
+	value, err = creds.lookup(context.Background(), cred)
+	if err != nil || value != "prompted" {
+		t.Errorf("expected credential to be prompted for, got '%s' (%v)", value, err)
+	}
+}
+
+func TestCredentialsLookupNonInteractive(t *testing.T) {
+	t.Setenv("U1_LOGIN", "")
+
+	creds := Credentials{Prompter: NonInteractivePrompter{}}
+
+	_, err := creds.lookup(context.Background(), ubuntuOneLogin)
+
+	var authErr *AuthRequiredError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("expected an AuthRequiredError when unable to prompt, got %v", err)
+	}
+
+	if authErr.Label != ubuntuOneLogin.Label {
+		t.Errorf("expected the error to name '%s', got '%s'", ubuntuOneLogin.Label, authErr.Label)
+	}
+}
+
+func TestUbuntuOneLogin(t *testing.T) {
+	t.Setenv("U1_LOGIN", "")
+	t.Setenv("U1_PASSWORD", "")
+	t.Setenv("U1_TOTP_SECRET", "")
+
+	srv := fakeLoginServer(t, "/+login", []map[string]string{
+		{"id_email": "joe@example.com", "id_password": "hunter2"},
+		{"id_oath_token": "123456"},
+	})
+
+	prompter := &credentialstest.Prompter{Values: map[string]string{
+		"Ubuntu One Login":    "joe@example.com",
+		"Ubuntu One Password": "hunter2",
+		"Ubuntu One OTP":      "123456",
+	}}
+
+	g := testLoginGreenhouse(t, srv, LoginProviderUbuntuOne, "/+login", prompter)
+
+	err := g.Login(context.Background())
+	if err != nil {
+		t.Fatalf("failed to log in: %s", err.Error())
+	}
+
+	if _, err := os.Stat(g.cookies.path); err != nil {
+		t.Errorf("expected cookies to be saved after logging in")
+	}
+}
+
+func TestUbuntuOneLoginWrongOTP(t *testing.T) {
+	t.Setenv("U1_LOGIN", "joe@example.com")
+	t.Setenv("U1_PASSWORD", "hunter2")
+	t.Setenv("U1_TOTP_SECRET", "")
+
+	srv := fakeLoginServer(t, "/+login", []map[string]string{
+		{"id_email": "joe@example.com", "id_password": "hunter2"},
+		{"id_oath_token": "123456"},
+	})
+
+	prompter := &credentialstest.Prompter{Values: map[string]string{"Ubuntu One OTP": "000000"}}
+	g := testLoginGreenhouse(t, srv, LoginProviderUbuntuOne, "/+login", prompter)
+
+	err := g.Login(context.Background())
+	if !errors.Is(err, ErrNoSession) {
+		t.Errorf("expected login with the wrong otp to fail, got %v", err)
+	}
+
+	// The login and password should have been read from the environment
+	if len(prompter.Asked) != 1 {
+		t.Errorf("expected to be prompted only for the otp, was prompted for %v", prompter.Asked)
+	}
+}
+
+func TestUbuntuOneLoginTOTP(t *testing.T) {
+	t.Setenv("U1_LOGIN", "joe@example.com")
+	t.Setenv("U1_PASSWORD", "hunter2")
+	t.Setenv("U1_TOTP_SECRET", testTOTPSeed)
+
+	// The authenticator generates the code at a fixed time, so that it can't
+	// cross into the next period before the code is submitted
+	now := time.Now()
+	key, _ := totp.DecodeSecret(testTOTPSeed)
+	code := totp.Code(key, now, totp.DefaultOptions)
+
+	srv := fakeLoginServer(t, "/+login", []map[string]string{
+		{"id_email": "joe@example.com", "id_password": "hunter2"},
+		{"id_oath_token": code},
+	})
+
+	prompter := &credentialstest.Prompter{}
+	g := testLoginGreenhouse(t, srv, LoginProviderUbuntuOne, "/+login", prompter)
+	g.auth.(*UbuntuOneAuthenticator).now = func() time.Time { return now }
+
+	err := g.Login(context.Background())
+	if err != nil {
+		t.Fatalf("failed to log in: %s", err.Error())
+	}
+
+	if len(prompter.Asked) != 0 {
+		t.Errorf("expected no prompts when the otp is generated, was prompted for %v", prompter.Asked)
+	}
+}
+
+func TestGreenhousePasswordLogin(t *testing.T) {
+	t.Setenv("GREENHOUSE_LOGIN", "")
+	t.Setenv("GREENHOUSE_PASSWORD", "")
+
+	// Greenhouse asks for the email address and password on separate pages
+	srv := fakeLoginServer(t, "/users/sign_in", []map[string]string{
+		{"user_email": "joe@example.com"},
+		{"user_password": "hunter2"},
+	})
+
+	prompter := &credentialstest.Prompter{Values: map[string]string{
+		"Greenhouse Email":    "joe@example.com",
+		"Greenhouse Password": "hunter2",
+	}}
+
+	g := testLoginGreenhouse(t, srv, LoginProviderGreenhouse, "/users/sign_in", prompter)
+
+	err := g.Login(context.Background())
+	if err != nil {
+		t.Fatalf("failed to log in: %s", err.Error())
+	}
+}
+
+func TestNoopLogin(t *testing.T) {
+	srv := fakeLoginServer(t, "/login", []map[string]string{{"email": "joe@example.com"}})
+
+	g := testLoginGreenhouse(t, srv, LoginProviderNone, "/login", &credentialstest.Prompter{})
+
+	err := g.Login(context.Background())
+	if !errors.Is(err, ErrNoSession) {
+		t.Errorf("expected login without a session to fail, got %v", err)
+	}
+}
+
+// FakeSource is a credential source backed by a map of names to values
+type FakeSource map[string]string
+
+func (s FakeSource) Get(ctx context.Context, name string) (string, error) {
+	value, ok := s[name]
+	if !ok {
+		return "", credentials.ErrNotFound
+	}
+	return value, nil
+}
+
+// FailingSource is a credential source which can't be read
+type FailingSource struct{}
+
+func (s FailingSource) Get(ctx context.Context, name string) (string, error) {
+	return "", errors.New("source unavailable")
+}
+
+// testLoginGreenhouse constructs a Greenhouse client for a fake server, which
+// detects the server's login page and stores cookies in a temporary directory
+func testLoginGreenhouse(t *testing.T, srv *httptest.Server, provider, loginPath string, prompter Prompter) *Greenhouse {
+	t.Helper()
+
+	if _, err := findBrowser(); err != nil {
+		t.Skip("no browser available to launch")
+	}
+
+	g, err := newGreenhouse(Options{
+		BaseURL:          srv.URL,
+		LoginProvider:    provider,
+		LoginURLPatterns: []string{"^" + regexp.QuoteMeta(srv.URL+loginPath)},
+		Prompter:         prompter,
+		CookieFile:       filepath.Join(t.TempDir(), "cookies.json"),
+	})
+	if err != nil {
+		t.Fatalf("failed to construct greenhouse client: %s", err.Error())
+	}
+
+	g.ghb = &ghstatBrowser{cookies: g.cookies}
+	if err := g.ghb.Init(); err != nil {
+		t.Fatalf("failed to initialise browser: %s", err.Error())
+	}
+	t.Cleanup(func() { g.Close() })
+
+	return g
+}
+
+// fakeLoginServer starts a stand-in for Greenhouse which redirects to a login
+// page until a session is established. The login page presents a form for
+// each step, which must be submitted with the expected values. Once the last
+// step is complete, a session cookie is set.
+func fakeLoginServer(t *testing.T, loginPath string, steps []map[string]string) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session"); err != nil {
+			http.Redirect(w, r, loginPath, http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "<html><body>Dashboard</body></html>")
+	})
+
+	mux.HandleFunc(loginPath, func(w http.ResponseWriter, r *http.Request) {
+		step := 0
+
+		if r.Method == http.MethodPost {
+			r.ParseForm()
+			step, _ = strconv.Atoi(r.PostForm.Get("step"))
+
+			valid := true
+			for name, value := range steps[step] {
+				valid = valid && r.PostForm.Get(name) == value
+			}
+
+			if valid {
+				step++
+			}
+
+			if step == len(steps) {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "ok", Path: "/"})
+				http.Redirect(w, r, "/", http.StatusFound)
+				return
+			}
+		}
+
+		inputs := []string{}
+		for name := range steps[step] {
+			inputs = append(inputs, fmt.Sprintf(`<input id="%s" name="%s">`, name, name))
+		}
+
+		fmt.Fprintf(w, `<html><body><form method="post" action="%s"><input type="hidden" name="step" value="%d">%s<button type="submit">Continue</button></form></body></html>`,
+			loginPath, step, strings.Join(inputs, ""))
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
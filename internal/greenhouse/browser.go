@@ -1,12 +1,16 @@
 package greenhouse
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/launcher"
@@ -19,13 +23,28 @@ import (
 type Browser interface {
 	Init() error
 	LoadCookies() error
-	SaveCookies() error
+	SaveCookies(host, account string) error
 	Browser() *rod.Browser
+	Close() error
 }
 
 // ghstatBrowser represents a ghstatBrowser and it's state in ghstat
 type ghstatBrowser struct {
-	browser *rod.Browser
+	browser  *rod.Browser
+	launcher *launcher.Launcher
+	// controlURL is the address of an existing browser's DevTools endpoint. When
+	// set, ghstat connects to that browser rather than launching its own.
+	controlURL string
+	// disconnect closes the connection to a remote browser
+	disconnect context.CancelFunc
+	// cookies stores cookies between sessions
+	cookies *cookieStore
+}
+
+// defaultCookieFile returns the path of the file in the user's config directory
+// in which cookies are stored between sessions
+func defaultCookieFile() string {
+	return filepath.Join(configdir.LocalConfig("ghstat"), "ghstat.json")
 }
 
 // Browser returns a pointer to the underlying rod.Browser instance
@@ -37,6 +56,10 @@ func (b *ghstatBrowser) Browser() *rod.Browser {
 // attempts to login in Greenhouse, first by using saved cookies in a known
 // location, and secondly by prompting for login, password and OTP.
 func (b *ghstatBrowser) Init() error {
+	if len(b.controlURL) > 0 {
+		return b.connectRemote()
+	}
+
 	// Get the path to the user's browser using a list of predefined browser bin names
 	path, err := findBrowser()
 	if err != nil {
@@ -44,6 +67,7 @@ func (b *ghstatBrowser) Init() error {
 	}
 
 	l := launcher.New().Bin(path)
+	b.launcher = l
 
 	// If we're inside a snap, use the `--no-sandbox` flag.
 	if len(os.Getenv("SNAP")) > 0 {
@@ -60,66 +84,120 @@ func (b *ghstatBrowser) Init() error {
 
 	err = b.browser.Connect()
 	if err != nil {
+		b.browser = nil
+		b.Close()
 		return fmt.Errorf("failed to connect to browser control url: %w", err)
 	}
 	slog.Debug("connected to browser control url")
 	return nil
 }
 
-// loadCookies attempts to load cookies from a previous ghstat session
-// from the users config directory
-func (b *ghstatBrowser) LoadCookies() error {
-	cookies := []*proto.NetworkCookieParam{}
+// connectRemote connects to an existing browser using its DevTools endpoint,
+// which can either be a WebSocket URL or the address of its debugging port.
+func (b *ghstatBrowser) connectRemote() error {
+	u := b.controlURL
+	if !strings.HasPrefix(u, "ws://") && !strings.HasPrefix(u, "wss://") {
+		resolved, err := launcher.ResolveURL(u)
+		if err != nil {
+			return fmt.Errorf("failed to resolve browser url '%s': %w", u, err)
+		}
+		u = resolved
+	}
 
-	configPath := configdir.LocalConfig("ghstat")
-	configFile := filepath.Join(configPath, "ghstat.json")
+	// The connection lasts as long as this context, so it can be closed without
+	// asking the remote browser to exit.
+	ctx, cancel := context.WithCancel(context.Background())
 
-	buf, err := os.ReadFile(configFile)
+	browser := rod.New().Context(ctx).ControlURL(u)
+	err := browser.Connect()
 	if err != nil {
-		return fmt.Errorf("failed to open cookie store file: %w", err)
+		cancel()
+		return fmt.Errorf("failed to connect to browser at '%s': %w", b.controlURL, err)
 	}
 
-	err = json.Unmarshal(buf, &cookies)
+	// Work in a separate browser context, so that pages and cookies are isolated
+	// from other users of the browser, and can be discarded when we're done.
+	incognito, err := browser.Incognito()
 	if err != nil {
-		return fmt.Errorf("failed to parse cookie store file: %w", err)
+		cancel()
+		return fmt.Errorf("failed to create browser context: %w", err)
 	}
 
-	err = b.browser.SetCookies(cookies)
-	if err != nil {
-		return fmt.Errorf("failed to load cookies into browser: %w", err)
+	b.browser = incognito
+	b.disconnect = cancel
+	slog.Debug("connected to remote browser", "host", browserHost(b.controlURL))
+	return nil
+}
+
+// Close shuts down the browser, ensuring that the browser process has exited
+// and that its temporary profile directory is removed. A remote browser is
+// left running, and only the browser context created by ghstat is discarded.
+// It is safe to call Close more than once.
+func (b *ghstatBrowser) Close() error {
+	var errs []error
+
+	if b.browser != nil {
+		// For a remote browser, this disposes of the incognito browser context
+		// rather than closing the browser itself.
+		err := b.browser.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to close browser: %w", err))
+		}
+		b.browser = nil
 	}
 
-	return nil
+	if b.disconnect != nil {
+		b.disconnect()
+		b.disconnect = nil
+		slog.Debug("disconnected from remote browser")
+	}
+
+	if b.launcher != nil {
+		// Kill the process in case closing the browser gracefully failed, then
+		// wait for it to exit and remove the user data directory.
+		b.launcher.Kill()
+		b.launcher.Cleanup()
+		b.launcher = nil
+		slog.Debug("closed browser and removed profile directory")
+	}
+
+	return errors.Join(errs...)
 }
 
-// saveCookies dumps all the cookies from the browser's current session
-// into a file in the users config directory
-func (b *ghstatBrowser) SaveCookies() error {
-	// Save the cookies to the cookies file
-	cookies, _ := b.browser.GetCookies()
-	buf, err := json.MarshalIndent(cookies, "", "  ")
+// loadCookies attempts to load cookies from a previous ghstat session
+// from the users config directory
+func (b *ghstatBrowser) LoadCookies() error {
+	if b.cookies == nil {
+		return errors.New("no cookie store configured")
+	}
+
+	sess, err := b.cookies.Load()
 	if err != nil {
-		return fmt.Errorf("could not marshal cookie data: %w", err)
+		return err
 	}
 
-	configPath := configdir.LocalConfig("ghstat")
-	err = configdir.MakePath(configPath)
+	err = b.browser.SetCookies(proto.CookiesToParams(sess.Cookies))
 	if err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+		return fmt.Errorf("failed to load cookies into browser: %w", err)
 	}
 
-	// Deal with a JSON configuration file in that folder.
-	configFile := filepath.Join(configPath, "ghstat.json")
+	return nil
+}
 
-	f, err := os.Create(configFile)
-	if err != nil {
-		return fmt.Errorf("could create cookie file: %w", err)
+// saveCookies dumps all the cookies from the browser's current session
+// into a file in the users config directory, noting the Greenhouse host and
+// the account they belong to
+func (b *ghstatBrowser) SaveCookies(host, account string) error {
+	if b.cookies == nil {
+		return errors.New("no cookie store configured")
 	}
 
-	defer f.Close()
-	f.Write(buf)
+	cookies, err := b.browser.GetCookies()
+	if err != nil {
+		return fmt.Errorf("failed to read cookies from browser: %w", err)
+	}
 
-	return nil
+	return b.cookies.Save(&session{Host: host, Account: account, Saved: time.Now(), Cookies: cookies})
 }
 
 // findBrowser is a helper utility to get the path of a browser that ghstat
@@ -143,3 +221,13 @@ func findBrowser() (string, error) {
 
 	return "", fmt.Errorf("could not find suitable browser in $PATH")
 }
+
+// browserHost returns the host of a browser's control URL, omitting the path,
+// which identifies the browser session and grants control of it
+func browserHost(controlURL string) string {
+	u, err := url.Parse(controlURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,16 @@
+package greenhouse
+
+import "testing"
+
+func TestRemoteBrowserUnreachable(t *testing.T) {
+	b := &ghstatBrowser{controlURL: "http://127.0.0.1:1"}
+
+	err := b.Init()
+	if err == nil {
+		t.Fatalf("expected an error connecting to an unreachable browser")
+	}
+
+	if b.launcher != nil || b.browser != nil {
+		t.Errorf("expected no browser to be launched or connected")
+	}
+}
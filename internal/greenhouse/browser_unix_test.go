@@ -0,0 +1,106 @@
+//go:build unix
+
+package greenhouse
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/launcher/flags"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+func TestBrowserCloseNoLeaks(t *testing.T) {
+	if _, err := findBrowser(); err != nil {
+		t.Skip("no browser available to launch")
+	}
+
+	b := &ghstatBrowser{}
+	err := b.Init()
+	if err != nil {
+		t.Fatalf("failed to initialise browser: %s", err.Error())
+	}
+
+	pid := b.launcher.PID()
+	profileDir := b.launcher.Get(flags.UserDataDir)
+
+	err = b.Close()
+	if err != nil {
+		t.Errorf("failed to close browser: %s", err.Error())
+	}
+
+	// The browser process may take a moment to be reaped once killed
+	deadline := time.Now().Add(5 * time.Second)
+	for syscall.Kill(pid, 0) == nil && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+		t.Errorf("browser process %d still running after close", pid)
+	}
+
+	if _, err := os.Stat(profileDir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("browser profile directory '%s' not removed after close", profileDir)
+	}
+
+	// Closing a second time should be a no-op
+	if err := b.Close(); err != nil {
+		t.Errorf("unexpected error closing browser twice: %s", err.Error())
+	}
+}
+
+func TestRemoteBrowserLeftRunning(t *testing.T) {
+	path, err := findBrowser()
+	if err != nil {
+		t.Skip("no browser available to launch")
+	}
+
+	// Start a browser which ghstat hasn't launched itself
+	l := launcher.New().Bin(path)
+	u, err := l.Launch()
+	if err != nil {
+		t.Fatalf("failed to launch browser: %s", err.Error())
+	}
+	t.Cleanup(l.Cleanup)
+	t.Cleanup(l.Kill)
+
+	b := &ghstatBrowser{controlURL: u}
+	err = b.Init()
+	if err != nil {
+		t.Fatalf("failed to connect to remote browser: %s", err.Error())
+	}
+
+	if b.launcher != nil {
+		t.Errorf("expected no browser to be launched when connecting to a remote browser")
+	}
+
+	// Cookies should be readable and writable over the connection
+	cookie := &proto.NetworkCookieParam{Name: "session", Value: "abc", Domain: "example.com", Path: "/"}
+	if err := b.browser.SetCookies([]*proto.NetworkCookieParam{cookie}); err != nil {
+		t.Fatalf("failed to set cookies on remote browser: %s", err.Error())
+	}
+
+	cookies, err := b.browser.GetCookies()
+	if err != nil || len(cookies) != 1 || cookies[0].Value != "abc" {
+		t.Errorf("failed to read cookies back from remote browser: %v, %v", cookies, err)
+	}
+
+	err = b.Close()
+	if err != nil {
+		t.Errorf("failed to close remote browser: %s", err.Error())
+	}
+
+	if err := syscall.Kill(l.PID(), 0); err != nil {
+		t.Errorf("remote browser process %d was stopped by close", l.PID())
+	}
+
+	// The browser should still accept connections
+	if err := rod.New().ControlURL(u).Connect(); err != nil {
+		t.Errorf("failed to reconnect to remote browser after close: %s", err.Error())
+	}
+}
@@ -0,0 +1,295 @@
+package greenhouse
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-rod/rod"
+)
+
+// Candidate is a single candidate listed for a role
+type Candidate struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Stage        string `json:"stage"`
+	LastActivity string `json:"lastActivity"`
+	URL          string `json:"url"`
+}
+
+// CandidateList is the set of candidates for a role which match a metric
+type CandidateList struct {
+	RoleID     int64       `json:"roleId"`
+	Title      string      `json:"title"`
+	Lead       string      `json:"lead"`
+	Metric     string      `json:"metric"`
+	Candidates []Candidate `json:"candidates"`
+	// Retry controls how fetches which fail transiently are retried
+	Retry  RetryPolicy `json:"-"`
+	metric Metric
+}
+
+// NewCandidateList constructs a CandidateList for a role, which will list the
+// candidates matching the specified metric when populated
+func NewCandidateList(roleId int64, lead string, metric Metric) *CandidateList {
+	return &CandidateList{
+		RoleID:     roleId,
+		Lead:       lead,
+		Metric:     metric.Key,
+		Candidates: []Candidate{},
+		metric:     metric,
+	}
+}
+
+// Populate fetches the title of the role, and the candidates which match the
+// queries of the list's metric, retrying any fetches which fail transiently
+func (l *CandidateList) Populate(ctx context.Context, g GreenhouseClient) error {
+	slog.Debug("listing candidates", "roleId", l.RoleID, "metric", l.Metric)
+
+	var title string
+	_, err := l.Retry.Do(ctx, func() (err error) {
+		title, err = g.RoleTitle(ctx, l.RoleID)
+		return err
+	}, "role", l.RoleID, "field", "title")
+	if err != nil {
+		return fmt.Errorf("failed to retrieve title for role %d: %w", l.RoleID, err)
+	}
+	l.Title = title
+
+	query, err := l.metric.Evaluate()
+	if err != nil {
+		return err
+	}
+
+	policy := l.Retry
+	if l.metric.Attempts > 0 {
+		policy.Attempts = l.metric.Attempts
+	}
+
+	var candidates []Candidate
+	_, err = policy.Do(ctx, func() (err error) {
+		candidates, err = g.Candidates(ctx, l.RoleID, query)
+		return err
+	}, "role", l.RoleID, "field", l.Metric)
+	if err != nil {
+		return fmt.Errorf("failed to list candidates for role %d: %w", l.RoleID, err)
+	}
+	l.Candidates = candidates
+
+	return nil
+}
+
+// candidateSelectors are the CSS selectors used to scrape each candidate row
+// from a candidates page
+var candidateSelectors = struct {
+	row, name, stage, lastActivity string
+}{
+	row:          ".person",
+	name:         ".name a",
+	stage:        ".stage-name",
+	lastActivity: ".last-activity",
+}
+
+// personPathRegexp extracts the candidate ID from the path of a candidate's profile
+var personPathRegexp = regexp.MustCompile(`/people/(\d+)`)
+
+// Candidates lists the candidates on the candidates page for a role with the
+// specified query parameters, following the page's pagination until every
+// candidate has been listed
+func (g *Greenhouse) Candidates(ctx context.Context, roleId int64, query Query) ([]Candidate, error) {
+	return paginate(roleId, query, func(q Query) ([]Candidate, int, error) {
+		return g.candidatesPage(ctx, roleId, q)
+	})
+}
+
+// paginate fetches successive pages of candidates with fetch, which returns
+// the candidates on a page along with the total across all pages, until every
+// candidate has been listed. Pagination stops early if a page lists only
+// candidates which have already been listed, such as when the page number is
+// ignored, so that the same page isn't fetched forever.
+func paginate(roleId int64, query Query, fetch func(q Query) ([]Candidate, int, error)) ([]Candidate, error) {
+	candidates := []Candidate{}
+	seen := map[int64]bool{}
+
+	for pageNum := 1; ; pageNum++ {
+		q := Query{Raw: query.Raw, Values: maps.Clone(query.Values)}
+		if q.Values == nil {
+			q.Values = FilterSet{}
+		}
+
+		// The first page is requested without a page number, so that it matches
+		// the page fetched when counting candidates
+		if pageNum > 1 {
+			q.Values["page"] = strconv.Itoa(pageNum)
+		}
+
+		rows, total, err := fetch(q)
+		if err != nil {
+			return nil, err
+		}
+
+		added := 0
+		for _, c := range rows {
+			if !seen[c.ID] {
+				seen[c.ID] = true
+				candidates = append(candidates, c)
+				added++
+			}
+		}
+
+		if len(rows) == 0 || len(candidates) >= total {
+			break
+		}
+
+		if added == 0 {
+			slog.Warn("stopped listing candidates at a page of candidates already listed", "role", roleId, "page", pageNum, "listed", len(candidates), "total", total)
+			break
+		}
+		slog.Debug("fetching next page of candidates", "role", roleId, "page", pageNum+1, "listed", len(candidates), "total", total)
+	}
+
+	return candidates, nil
+}
+
+// candidatesPage scrapes the candidate rows from a single candidates page,
+// along with the total number of candidates across all pages
+func (g *Greenhouse) candidatesPage(ctx context.Context, roleId int64, query Query) ([]Candidate, int, error) {
+	page, err := g.getCandidatesPage(ctx, roleId, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to retrieve candidate page: %w", err)
+	}
+	defer closePage(page)
+
+	total, err := countCandidates(page)
+	if err != nil {
+		g.captureFailure(page, roleId, query.Values, err)
+		return nil, 0, err
+	}
+
+	if total == 0 {
+		return []Candidate{}, 0, nil
+	}
+
+	candidates, err := scrapeCandidates(page, g.baseUrl)
+	if err != nil {
+		g.captureFailure(page, roleId, query.Values, err)
+		return nil, 0, err
+	}
+
+	return candidates, total, nil
+}
+
+// scrapeCandidates reads the details of each candidate row on a candidates page
+// of the Greenhouse instance at base
+func scrapeCandidates(page *rod.Page, base *url.URL) ([]Candidate, error) {
+	rows, err := page.Elements(candidateSelectors.row)
+	if err != nil {
+		return nil, &FetchError{Kind: ErrorKindMissingElement, Err: fmt.Errorf("failed to find candidate rows: %w", err)}
+	}
+
+	candidates := []Candidate{}
+	for _, row := range rows {
+		link, err := childElement(row, candidateSelectors.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find candidate name: %w", err)
+		}
+		if link == nil {
+			return nil, fmt.Errorf("failed to find candidate name in row")
+		}
+
+		c := Candidate{}
+
+		c.Name, err = link.Text()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read candidate name: %w", err)
+		}
+		c.Name = strings.TrimSpace(c.Name)
+
+		href, err := link.Attribute("href")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read link for candidate '%s': %w", c.Name, err)
+		}
+		if href == nil {
+			return nil, fmt.Errorf("no link found for candidate '%s'", c.Name)
+		}
+
+		c.URL, c.ID, err = candidateLink(page, base, *href)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Stage, err = childText(row, candidateSelectors.stage)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stage for candidate '%s': %w", c.Name, err)
+		}
+
+		c.LastActivity, err = childText(row, candidateSelectors.lastActivity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read last activity for candidate '%s': %w", c.Name, err)
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	return candidates, nil
+}
+
+// candidateLink resolves the link to a candidate's profile against the URL of
+// the page it was found on, and extracts the candidate's ID from it
+func candidateLink(page *rod.Page, base *url.URL, href string) (string, int64, error) {
+	link, err := url.Parse(href)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to parse candidate link '%s': %w", href, err)
+	}
+
+	// Replayed pages have no URL of their own, so are resolved against the base
+	if info, err := page.Info(); err == nil && strings.HasPrefix(info.URL, "http") {
+		if pageUrl, err := url.Parse(info.URL); err == nil {
+			base = pageUrl
+		}
+	}
+	link = base.ResolveReference(link)
+
+	m := personPathRegexp.FindStringSubmatch(link.Path)
+	if m == nil {
+		return "", 0, fmt.Errorf("failed to find candidate id in link '%s'", href)
+	}
+
+	id, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to parse candidate id in link '%s': %w", href, err)
+	}
+
+	return link.String(), id, nil
+}
+
+// childElement returns the first element matching a selector within el, or nil
+// if there is no such element. Unlike el.Element, it does not wait for a
+// matching element to appear.
+func childElement(el *rod.Element, selector string) (*rod.Element, error) {
+	children, err := el.Elements(selector)
+	if err != nil || len(children) == 0 {
+		return nil, err
+	}
+	return children[0], nil
+}
+
+// childText returns the trimmed text of the first element matching a selector
+// within el, or an empty string if there is no such element
+func childText(el *rod.Element, selector string) (string, error) {
+	child, err := childElement(el, selector)
+	if err != nil || child == nil {
+		return "", err
+	}
+
+	text, err := child.Text()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text), nil
+}
@@ -0,0 +1,97 @@
+package greenhouse
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+func TestScrapeCandidates(t *testing.T) {
+	if _, err := findBrowser(); err != nil {
+		t.Skip("no browser available to launch")
+	}
+
+	b := &ghstatBrowser{}
+	if err := b.Init(); err != nil {
+		t.Fatalf("failed to initialise browser: %s", err.Error())
+	}
+	defer b.Close()
+
+	html, err := os.ReadFile(filepath.Join("testdata", "candidates", "page.html"))
+	if err != nil {
+		t.Fatalf("failed to read test page: %s", err.Error())
+	}
+
+	page, err := b.browser.Page(proto.TargetCreateTarget{URL: "about:blank"})
+	if err != nil {
+		t.Fatalf("failed to open page: %s", err.Error())
+	}
+	page.SetDocumentContent(string(html))
+
+	base, _ := url.Parse(DefaultBaseURL)
+	candidates, err := scrapeCandidates(page, base)
+	if err != nil {
+		t.Fatalf("failed to scrape candidates: %s", err.Error())
+	}
+
+	expected := []Candidate{
+		{ID: 1001, Name: "Jane Doe", Stage: "Application Review", LastActivity: "Jun 1, 2024", URL: "https://canonical.greenhouse.io/people/1001?application_id=2001"},
+		{ID: 1002, Name: "John Smith", Stage: "Written Interview", URL: "https://canonical.greenhouse.io/people/1002?application_id=2002"},
+	}
+
+	if len(candidates) != len(expected) {
+		t.Fatalf("expected %d candidates, got %d", len(expected), len(candidates))
+	}
+
+	for i, c := range candidates {
+		if c != expected[i] {
+			t.Errorf("incorrect candidate scraped, expected %+v, got %+v", expected[i], c)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	pages := map[string][]Candidate{
+		"":  {{ID: 1}, {ID: 2}},
+		"2": {{ID: 3}, {ID: 4}},
+		"3": {{ID: 5}},
+	}
+
+	fetched := []string{}
+	candidates, err := paginate(123, Query{Values: FilterSet{"in_stages[]": "Hold"}}, func(q Query) ([]Candidate, int, error) {
+		if q.Values["in_stages[]"] != "Hold" {
+			t.Errorf("expected queries to be passed to each page, got %v", q.Values)
+		}
+		fetched = append(fetched, q.Values["page"])
+		return pages[q.Values["page"]], 5, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to paginate: %s", err.Error())
+	}
+
+	if len(candidates) != 5 || len(fetched) != 3 {
+		t.Errorf("expected 5 candidates from 3 pages, got %d from %v", len(candidates), fetched)
+	}
+}
+
+func TestPaginatePageIgnored(t *testing.T) {
+	calls := 0
+	candidates, err := paginate(123, Query{}, func(q Query) ([]Candidate, int, error) {
+		calls++
+		if calls > 10 {
+			t.Fatalf("expected pagination to stop when the page number is ignored")
+		}
+		// Every page is the first page
+		return []Candidate{{ID: 1}, {ID: 2}}, 50, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to paginate: %s", err.Error())
+	}
+
+	if len(candidates) != 2 || calls != 2 {
+		t.Errorf("expected 2 candidates from 2 fetches, got %d from %d", len(candidates), calls)
+	}
+}
@@ -0,0 +1,378 @@
+package greenhouse
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"jnsgruk/ghstat/internal/credentials"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Methods of encrypting the cookie store
+const (
+	CookieEncryptionNone       = "none"
+	CookieEncryptionKeyring    = "keyring"
+	CookieEncryptionPassphrase = "passphrase"
+)
+
+// cookieKey is the name of the cookie store's key in the keyring
+const cookieKey = "cookies/key"
+
+// cookiePassphrase is the passphrase from which the cookie store's key is
+// derived, when it is not kept in the keyring
+var cookiePassphrase = Credential{Name: "cookies/passphrase", Env: "GHSTAT_COOKIE_PASSPHRASE", Label: "Cookie Store Passphrase", Secret: true}
+
+// pbkdf2Iterations is the number of iterations used to derive a key from a
+// passphrase, as recommended by OWASP for PBKDF2-HMAC-SHA256
+const pbkdf2Iterations = 600_000
+
+// cookieStore persists the browser's cookies between sessions in a file which is
+// only accessible by the user, and is optionally encrypted. The file is locked
+// while it is read or written, so that concurrent runs don't corrupt it.
+type cookieStore struct {
+	path string
+	// key returns the AES-256 key used to encrypt the store, given the salt
+	// stored alongside the cookies. The store is not encrypted if key is nil.
+	key func(salt []byte) ([]byte, error)
+}
+
+// session is the content of the cookie store: the cookies of a Greenhouse
+// session, and details of the account they belong to
+type session struct {
+	Host    string                 `json:"host"`
+	Account string                 `json:"account,omitempty"`
+	Saved   time.Time              `json:"saved"`
+	Cookies []*proto.NetworkCookie `json:"cookies"`
+}
+
+// encryptedCookies is the format of an encrypted cookie store, in which the
+// session is encrypted. Plaintext stores contain the session itself, or a JSON
+// array of cookies if written by previous versions of ghstat.
+type encryptedCookies struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// newCookieStore constructs a store at the specified path, which is encrypted
+// with a key from the keyring, a passphrase looked up with creds, or not at all
+func newCookieStore(path, encryption string, creds Credentials, keyring credentials.Keyring) (*cookieStore, error) {
+	s := &cookieStore{path: path}
+
+	switch encryption {
+	case "", CookieEncryptionNone:
+	case CookieEncryptionKeyring:
+		s.key = keyringKey(keyring)
+	case CookieEncryptionPassphrase:
+		s.key = passphraseKey(creds)
+	default:
+		return nil, fmt.Errorf("unsupported cookie encryption '%s', please choose one of '%s', '%s' or '%s'",
+			encryption, CookieEncryptionNone, CookieEncryptionKeyring, CookieEncryptionPassphrase)
+	}
+
+	return s, nil
+}
+
+// Load reads the session from the store. A plaintext store is encrypted if
+// encryption is enabled, and a store readable by other users has its
+// permissions restricted, such that files written by previous versions of
+// ghstat are migrated.
+func (s *cookieStore) Load() (*session, error) {
+	unlock, err := s.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cookie store file: %w", err)
+	}
+
+	buf, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cookie store file: %w", err)
+	}
+
+	data, encrypted, err := s.decode(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := &session{}
+	legacy := bytes.HasPrefix(bytes.TrimSpace(data), []byte("["))
+	if legacy {
+		err = json.Unmarshal(data, &sess.Cookies)
+	} else {
+		err = json.Unmarshal(data, sess)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cookie store file: %w", err)
+	}
+
+	if legacy || (!encrypted && s.key != nil) {
+		slog.Info("migrating cookie store", "file", s.path, "encrypted", s.key != nil)
+		err = s.write(sess)
+		if err != nil {
+			return nil, err
+		}
+	} else if info.Mode().Perm()&0077 != 0 {
+		slog.Info("restricting permissions of cookie store", "file", s.path)
+		err = os.Chmod(s.path, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restrict permissions of cookie store file: %w", err)
+		}
+	}
+
+	return sess, nil
+}
+
+// Save replaces the session in the store
+func (s *cookieStore) Save(sess *session) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return s.write(sess)
+}
+
+// Clear removes the session from the store
+func (s *cookieStore) Clear() error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	err = os.Remove(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove cookie store file: %w", err)
+	}
+
+	return nil
+}
+
+// write encodes the session and atomically replaces the store file, so that it
+// is never left partially written. The caller must hold the lock.
+func (s *cookieStore) write(sess *session) error {
+	if sess.Cookies == nil {
+		sess.Cookies = []*proto.NetworkCookie{}
+	}
+
+	data, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal cookie data: %w", err)
+	}
+
+	buf, err := s.encode(data)
+	if err != nil {
+		return err
+	}
+
+	// Temporary files are created with 0600 permissions
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cookie store file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(buf)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write cookie store file: %w", err)
+	}
+
+	err = os.Rename(f.Name(), s.path)
+	if err != nil {
+		return fmt.Errorf("failed to replace cookie store file: %w", err)
+	}
+
+	return nil
+}
+
+// lock takes an exclusive advisory lock on the store, returning a function
+// which releases it. A separate lock file is used, as the store itself is
+// replaced when it is written.
+func (s *cookieStore) lock() (func(), error) {
+	err := os.MkdirAll(filepath.Dir(s.path), 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	f, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cookie store lock file: %w", err)
+	}
+
+	err = lockFile(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock cookie store: %w", err)
+	}
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// encode encrypts the cookies if encryption is enabled
+func (s *cookieStore) encode(data []byte) ([]byte, error) {
+	if s.key == nil {
+		return data, nil
+	}
+
+	salt := make([]byte, 16)
+	rand.Read(salt)
+
+	key, err := s.key(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+
+	return json.MarshalIndent(encryptedCookies{
+		Version: 1,
+		Salt:    salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, data, nil),
+	}, "", "  ")
+}
+
+// decode returns the session in a store file, and whether the file was
+// encrypted
+func (s *cookieStore) decode(buf []byte) ([]byte, bool, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(buf), []byte("[")) {
+		return buf, false, nil
+	}
+
+	enc := encryptedCookies{}
+	err := json.Unmarshal(buf, &enc)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse cookie store file: %w", err)
+	}
+
+	if len(enc.Data) == 0 {
+		return buf, false, nil
+	}
+
+	if s.key == nil {
+		return nil, false, errors.New("cookie store is encrypted, but cookie encryption is not configured")
+	}
+
+	if enc.Version != 1 {
+		return nil, false, fmt.Errorf("unsupported cookie store version %d", enc.Version)
+	}
+
+	key, err := s.key(enc.Salt)
+	if err != nil {
+		return nil, false, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(enc.Nonce) != gcm.NonceSize() {
+		return nil, false, errors.New("failed to decrypt cookie store: invalid nonce")
+	}
+
+	data, err := gcm.Open(nil, enc.Nonce, enc.Data, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decrypt cookie store, the key or passphrase may have changed: %w", err)
+	}
+
+	return data, true, nil
+}
+
+// newGCM constructs an AES-GCM cipher with the specified key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cookie store cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// passphraseKey derives keys from a passphrase, which is looked up the first
+// time a key is required
+func passphraseKey(creds Credentials) func([]byte) ([]byte, error) {
+	var passphrase string
+
+	return func(salt []byte) ([]byte, error) {
+		if len(passphrase) == 0 {
+			p, err := creds.lookup(context.Background(), cookiePassphrase)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read cookie store passphrase: %w", err)
+			}
+			if len(p) == 0 {
+				return nil, errors.New("empty cookie store passphrase")
+			}
+			passphrase = p
+		}
+
+		return pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Iterations, 32)
+	}
+}
+
+// keyringKey returns a random key kept in the keyring, which is generated the
+// first time it is required. As the key is random, the salt is not used.
+func keyringKey(keyring credentials.Keyring) func([]byte) ([]byte, error) {
+	var key []byte
+
+	return func(salt []byte) ([]byte, error) {
+		if key != nil {
+			return key, nil
+		}
+
+		encoded, err := keyring.Get(context.Background(), cookieKey)
+		if errors.Is(err, credentials.ErrNotFound) {
+			buf := make([]byte, 32)
+			rand.Read(buf)
+			encoded = base64.StdEncoding.EncodeToString(buf)
+
+			err = keyring.Store(context.Background(), cookieKey, encoded)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cookie store key from keyring: %w", err)
+		}
+
+		key, err = base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			key = nil
+			return nil, errors.New("invalid cookie store key in keyring")
+		}
+
+		return key, nil
+	}
+}
@@ -0,0 +1,202 @@
+package greenhouse
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"jnsgruk/ghstat/internal/credentials"
+	"jnsgruk/ghstat/internal/credentials/credentialstest"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+var testCookies = []*proto.NetworkCookie{
+	{Name: "session", Value: "s3cr3t-session", Domain: "canonical.greenhouse.io", Path: "/"},
+}
+
+func TestCookieStore(t *testing.T) {
+	s := testCookieStore(t, CookieEncryptionNone, nil)
+
+	if err := s.Save(&session{Host: "canonical.greenhouse.io", Cookies: testCookies}); err != nil {
+		t.Fatalf("failed to save cookies: %s", err.Error())
+	}
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		t.Fatalf("cookie store not created: %s", err.Error())
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("incorrect cookie store permissions, expected 0600, got %s", info.Mode().Perm())
+	}
+
+	assertCookies(t, s)
+}
+
+func TestCookieStorePassphrase(t *testing.T) {
+	t.Setenv("GHSTAT_COOKIE_PASSPHRASE", "")
+
+	prompter := &credentialstest.Prompter{Values: map[string]string{"Cookie Store Passphrase": "correct horse"}}
+	s := testCookieStore(t, CookieEncryptionPassphrase, prompter)
+
+	if err := s.Save(&session{Host: "canonical.greenhouse.io", Cookies: testCookies}); err != nil {
+		t.Fatalf("failed to save cookies: %s", err.Error())
+	}
+
+	assertEncrypted(t, s.path)
+	assertCookies(t, s)
+
+	// The passphrase should only be asked for once per run
+	if len(prompter.Asked) != 1 {
+		t.Errorf("expected to be prompted for the passphrase once, was prompted %d times", len(prompter.Asked))
+	}
+
+	// A store with a different passphrase can't decrypt the cookies
+	t.Setenv("GHSTAT_COOKIE_PASSPHRASE", "battery staple")
+	other, _ := newCookieStore(s.path, CookieEncryptionPassphrase, Credentials{Prompter: &credentialstest.Prompter{}}, credentials.Keyring{})
+	if _, err := other.Load(); err == nil {
+		t.Errorf("expected an error loading cookies with the wrong passphrase")
+	}
+
+	// An unencrypted store can't read encrypted cookies
+	plain, _ := newCookieStore(s.path, CookieEncryptionNone, Credentials{}, credentials.Keyring{})
+	if _, err := plain.Load(); err == nil {
+		t.Errorf("expected an error loading encrypted cookies without encryption configured")
+	}
+}
+
+func TestCookieStoreKeyring(t *testing.T) {
+	keyring := credentialstest.NewKeyring(t)
+
+	s, err := newCookieStore(filepath.Join(t.TempDir(), "ghstat.json"), CookieEncryptionKeyring, Credentials{}, keyring)
+	if err != nil {
+		t.Fatalf("failed to construct cookie store: %s", err.Error())
+	}
+
+	if err := s.Save(&session{Host: "canonical.greenhouse.io", Cookies: testCookies}); err != nil {
+		t.Fatalf("failed to save cookies: %s", err.Error())
+	}
+
+	assertEncrypted(t, s.path)
+
+	// A new store should use the key saved in the keyring
+	s, _ = newCookieStore(s.path, CookieEncryptionKeyring, Credentials{}, keyring)
+	assertCookies(t, s)
+}
+
+func TestCookieStoreMigration(t *testing.T) {
+	t.Setenv("GHSTAT_COOKIE_PASSPHRASE", "correct horse")
+
+	for _, encryption := range []string{CookieEncryptionNone, CookieEncryptionPassphrase} {
+		s := testCookieStore(t, encryption, &credentialstest.Prompter{})
+
+		// Previous versions wrote plaintext cookies with default permissions
+		buf := []byte(`[{"name": "session", "value": "s3cr3t-session", "domain": "canonical.greenhouse.io", "path": "/"}]`)
+		if err := os.WriteFile(s.path, buf, 0644); err != nil {
+			t.Fatalf("failed to write cookie store: %s", err.Error())
+		}
+
+		assertCookies(t, s)
+
+		info, _ := os.Stat(s.path)
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("cookie store permissions not restricted with encryption '%s', got %s", encryption, info.Mode().Perm())
+		}
+
+		if encryption == CookieEncryptionPassphrase {
+			assertEncrypted(t, s.path)
+		} else if buf, _ := os.ReadFile(s.path); !bytes.HasPrefix(buf, []byte("{")) {
+			t.Errorf("cookie store not migrated to the current format")
+		}
+	}
+}
+
+func TestCookieStoreClear(t *testing.T) {
+	s := testCookieStore(t, CookieEncryptionNone, nil)
+
+	if err := s.Save(&session{Cookies: testCookies}); err != nil {
+		t.Fatalf("failed to save cookies: %s", err.Error())
+	}
+
+	if err := s.Clear(); err != nil {
+		t.Fatalf("failed to clear cookie store: %s", err.Error())
+	}
+
+	if _, err := s.Load(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected cookie store to be removed, got %v", err)
+	}
+
+	// Clearing an empty store should succeed
+	if err := s.Clear(); err != nil {
+		t.Errorf("failed to clear empty cookie store: %s", err.Error())
+	}
+}
+
+func TestCookieStoreConcurrentSaves(t *testing.T) {
+	s := testCookieStore(t, CookieEncryptionNone, nil)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if err := s.Save(&session{Host: "canonical.greenhouse.io", Cookies: testCookies}); err != nil {
+				t.Errorf("failed to save cookies: %s", err.Error())
+			}
+		})
+	}
+	wg.Wait()
+
+	assertCookies(t, s)
+
+	// Only the store and its lock file should remain
+	entries, _ := os.ReadDir(filepath.Dir(s.path))
+	if len(entries) != 2 {
+		t.Errorf("expected only the cookie store and lock file, found %d files", len(entries))
+	}
+}
+
+func TestNewCookieStoreInvalid(t *testing.T) {
+	if _, err := newCookieStore("ghstat.json", "rot13", Credentials{}, credentials.Keyring{}); err == nil {
+		t.Errorf("expected an error constructing a cookie store with unknown encryption")
+	}
+}
+
+// testCookieStore constructs a cookie store in a temporary directory
+func testCookieStore(t *testing.T, encryption string, prompter Prompter) *cookieStore {
+	t.Helper()
+
+	s, err := newCookieStore(filepath.Join(t.TempDir(), "ghstat.json"), encryption, Credentials{Prompter: prompter}, credentials.Keyring{})
+	if err != nil {
+		t.Fatalf("failed to construct cookie store: %s", err.Error())
+	}
+	return s
+}
+
+// assertCookies checks that the test cookies can be loaded from a store
+func assertCookies(t *testing.T, s *cookieStore) {
+	t.Helper()
+
+	sess, err := s.Load()
+	if err != nil {
+		t.Fatalf("failed to load cookies: %s", err.Error())
+	}
+
+	cookies := sess.Cookies
+	if len(cookies) != 1 || cookies[0].Name != "session" || cookies[0].Value != "s3cr3t-session" {
+		t.Errorf("incorrect cookies loaded from store: %+v", cookies)
+	}
+}
+
+// assertEncrypted checks that the value of the test cookie isn't readable in a
+// cookie store file
+func assertEncrypted(t *testing.T, path string) {
+	t.Helper()
+
+	buf, _ := os.ReadFile(path)
+	if bytes.Contains(buf, []byte("s3cr3t-session")) {
+		t.Errorf("cookie store file contains plaintext cookies")
+	}
+}
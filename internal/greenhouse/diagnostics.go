@@ -0,0 +1,88 @@
+package greenhouse
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// failure describes a candidates page which could not be scraped
+type failure struct {
+	RoleID  int64             `json:"roleId"`
+	Queries map[string]string `json:"queries"`
+	URL     string            `json:"url"`
+	Error   string            `json:"error"`
+	Time    time.Time         `json:"time"`
+}
+
+// captureFailure saves a screenshot and the HTML of a page which could not be
+// scraped into the debug directory, along with the URL and queries used to
+// fetch it. Failures to capture the page are logged rather than returned, so
+// as not to mask the original error.
+func (g *Greenhouse) captureFailure(page *rod.Page, roleId int64, queries map[string]string, cause error) {
+	if len(g.opts.DebugDir) == 0 {
+		return
+	}
+
+	err := saveFailure(g.opts.DebugDir, page, roleId, queries, cause)
+	if err != nil {
+		slog.Debug("failed to capture diagnostics for page", "role", roleId, "error", err.Error())
+		return
+	}
+	slog.Debug("captured diagnostics for page", "role", roleId, "key", pageKey(roleId, queries))
+}
+
+// saveFailure writes the diagnostics for a page into dir, with each file named
+// for the role and queries used to fetch the page
+func saveFailure(dir string, page *rod.Page, roleId int64, queries map[string]string, cause error) error {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create debug directory: %w", err)
+	}
+
+	key := pageKey(roleId, queries)
+	report := failure{RoleID: roleId, Queries: queries, Error: cause.Error(), Time: time.Now()}
+
+	info, err := page.Info()
+	if err == nil {
+		report.URL = info.URL
+	}
+
+	buf, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal failure data: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, key+".json"), buf, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write failure data: %w", err)
+	}
+
+	html, err := page.HTML()
+	if err != nil {
+		return fmt.Errorf("failed to read page html: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, key+".html"), []byte(html), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write page html: %w", err)
+	}
+
+	img, err := page.Screenshot(true, &proto.PageCaptureScreenshot{Format: proto.PageCaptureScreenshotFormatPng})
+	if err != nil {
+		return fmt.Errorf("failed to take screenshot: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, key+".png"), img, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write screenshot: %w", err)
+	}
+
+	return nil
+}
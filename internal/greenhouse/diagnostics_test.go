@@ -0,0 +1,52 @@
+package greenhouse
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-rod/rod/lib/proto"
+)
+
+func TestSaveFailure(t *testing.T) {
+	if _, err := findBrowser(); err != nil {
+		t.Skip("no browser available to launch")
+	}
+
+	b := &ghstatBrowser{}
+	if err := b.Init(); err != nil {
+		t.Fatalf("failed to initialise browser: %s", err.Error())
+	}
+	defer b.Close()
+
+	page, err := b.browser.Page(proto.TargetCreateTarget{URL: "about:blank"})
+	if err != nil {
+		t.Fatalf("failed to open page: %s", err.Error())
+	}
+	page.SetDocumentContent("<html><body>Unexpected layout</body></html>")
+
+	dir := t.TempDir()
+	queries := map[string]string{"in_stages[]": "Application Review"}
+
+	err = saveFailure(dir, page, 1234, queries, errors.New("element not found"))
+	if err != nil {
+		t.Fatalf("failed to save failure: %s", err.Error())
+	}
+
+	key := pageKey(1234, queries)
+	for _, ext := range []string{".json", ".html", ".png"} {
+		if _, err := os.Stat(filepath.Join(dir, key+ext)); err != nil {
+			t.Errorf("expected diagnostics file '%s' to be saved", key+ext)
+		}
+	}
+
+	buf, _ := os.ReadFile(filepath.Join(dir, key+".json"))
+	report := failure{}
+	json.Unmarshal(buf, &report)
+
+	if report.RoleID != 1234 || report.Error != "element not found" || report.Queries["in_stages[]"] != "Application Review" {
+		t.Errorf("incorrect failure report: %+v", report)
+	}
+}
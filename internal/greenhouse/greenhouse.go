@@ -1,186 +1,395 @@
 package greenhouse
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/url"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"jnsgruk/ghstat/internal/credentials"
+
 	"github.com/go-rod/rod"
 	"github.com/go-rod/rod/lib/proto"
-	"github.com/manifoldco/promptui"
 )
 
 // GreenhouseClient is an interface which defines methods used for interacting
 // with Greenhouse for the purposes of ghstat only
 type GreenhouseClient interface {
-	RoleTitle(int64) (string, error)
-	CandidateCount(int64, map[string]string) (int, error)
-	Login() error
+	RoleTitle(context.Context, int64) (string, error)
+	CandidateCount(context.Context, int64, Query) (int, error)
+	Candidates(context.Context, int64, Query) ([]Candidate, error)
+	Login(context.Context) error
+	Close() error
+}
+
+// CachingClient is implemented by clients which cache data fetched from
+// Greenhouse, so that long-running callers can discard stale data
+type CachingClient interface {
+	// Reset discards any cached data, so that it is fetched again
+	Reset()
 }
 
+// DefaultBaseURL is the address of the Greenhouse instance used by default
+const DefaultBaseURL = "https://canonical.greenhouse.io"
+
 // Greenhouse is an internal representation of an instance of Greenhouse
 type Greenhouse struct {
-	ghb *ghstatBrowser
+	ghb       *ghstatBrowser
+	opts      Options
+	auth      Authenticator
+	baseUrl   *url.URL
+	loginUrls []*regexp.Regexp
+	cookies   *cookieStore
 }
 
-func NewGreenhouse() (*Greenhouse, error) {
-	ghb := &ghstatBrowser{}
-	err := ghb.Init()
+// Options configures the behaviour of a Greenhouse client
+type Options struct {
+	// RecordDir is a directory into which the rendered HTML of each candidates
+	// page is saved as it is fetched
+	RecordDir string
+	// ReplayDir is a directory containing pages saved with RecordDir. When set,
+	// candidates pages are served from this directory rather than fetched from
+	// Greenhouse, and no login is performed.
+	ReplayDir string
+	// BrowserURL is the DevTools endpoint of an existing browser to connect to,
+	// rather than launching a new one
+	BrowserURL string
+	// DebugDir is a directory into which a screenshot, the HTML, the URL and the
+	// queries of any page which could not be scraped are saved
+	DebugDir string
+	// BaseURL is the address of the Greenhouse instance, which defaults to
+	// DefaultBaseURL
+	BaseURL string
+	// LoginProvider is the SSO provider used to log in to Greenhouse, which
+	// defaults to LoginProviderUbuntuOne
+	LoginProvider string
+	// LoginURLPatterns are regular expressions matching the URL of the login
+	// page that Greenhouse redirects to when there is no active session. They
+	// default to the login page of the login provider.
+	LoginURLPatterns []string
+	// CredentialSources are searched for the credentials required to log in,
+	// before falling back to environment variables and prompting
+	CredentialSources []credentials.Source
+	// Prompter is used to ask for any credentials required to log in, which
+	// defaults to prompting on the terminal
+	Prompter Prompter
+	// TOTPSecret describes where to find the seed used to generate one-time
+	// passwords, rather than prompting for them
+	TOTPSecret TOTPSecret
+	// CookieFile is the file in which cookies are stored between sessions,
+	// which defaults to a file in the user's config directory
+	CookieFile string
+	// CookieEncryption is how the cookie store is encrypted, which defaults to
+	// CookieEncryptionNone
+	CookieEncryption string
+}
+
+// NewGreenhouse constructs a new Greenhouse client, launching or connecting to
+// a browser and loading any cookies saved by previous sessions
+func NewGreenhouse(opts Options) (*Greenhouse, error) {
+	g, err := newGreenhouse(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ghb := &ghstatBrowser{controlURL: opts.BrowserURL, cookies: g.cookies}
+	err = ghb.Init()
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialise browser: %w", err)
 	}
+	g.ghb = ghb
+
+	// Cookies are only required when talking to Greenhouse
+	if len(opts.ReplayDir) == 0 {
+		err = ghb.LoadCookies()
+		if errors.Is(err, os.ErrNotExist) {
+			slog.Debug("no cookies saved by a previous session")
+		} else if err != nil {
+			slog.Warn("failed to load cookies for browser", "error", err.Error())
+		}
+	}
+
+	return g, nil
+}
+
+// newGreenhouse validates the options for a Greenhouse client, and constructs
+// a client without a browser
+func newGreenhouse(opts Options) (*Greenhouse, error) {
+	if len(opts.RecordDir) > 0 && len(opts.ReplayDir) > 0 {
+		return nil, fmt.Errorf("cannot record and replay pages at the same time")
+	}
+
+	baseUrl, err := ParseBaseURL(opts.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Prompter == nil {
+		opts.Prompter = TerminalPrompter{}
+	}
+	creds := Credentials{Sources: opts.CredentialSources, Prompter: opts.Prompter}
+
+	auth, err := NewAuthenticator(opts.LoginProvider, creds, opts.TOTPSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(opts.CookieFile) == 0 {
+		opts.CookieFile = defaultCookieFile()
+	}
 
-	err = ghb.LoadCookies()
+	cookies, err := newCookieStore(opts.CookieFile, opts.CookieEncryption, creds, credentials.Keyring{})
 	if err != nil {
-		slog.Debug("failed to load cookies for browser", "error", err.Error())
+		return nil, err
+	}
+
+	patterns := auth.LoginURLPatterns()
+	if len(opts.LoginURLPatterns) > 0 {
+		patterns = opts.LoginURLPatterns
+	}
+
+	loginUrls := []*regexp.Regexp{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid login url pattern '%s': %w", p, err)
+		}
+		loginUrls = append(loginUrls, re)
 	}
 
-	return &Greenhouse{ghb: ghb}, nil
+	return &Greenhouse{opts: opts, auth: auth, baseUrl: baseUrl, loginUrls: loginUrls, cookies: cookies}, nil
 }
 
 // CandidateCount is a helper method for requesting Greenhouse candidate pages with
 // a specified set of query parameters in the URL
-func (g *Greenhouse) CandidateCount(roleId int64, queries map[string]string) (int, error) {
-	page, err := g.getCandidatesPage(roleId, queries)
+func (g *Greenhouse) CandidateCount(ctx context.Context, roleId int64, query Query) (int, error) {
+	page, err := g.getCandidatesPage(ctx, roleId, query)
 	if err != nil {
 		return -1, fmt.Errorf("failed to retrieve candidate page: %w", err)
 	}
-	defer page.MustClose()
+	defer closePage(page)
+
+	count, err := countCandidates(page)
+	if err != nil {
+		g.captureFailure(page, roleId, query.Values, err)
+		return -1, err
+	}
+
+	return count, nil
+}
 
+// countCandidates reads the number of candidates listed on a candidates page
+func countCandidates(page *rod.Page) (int, error) {
 	// If this element is present, the number of results is zero
-	_, err = page.Timeout(500 * time.Millisecond).Element(".no_results--header")
+	_, err := page.Timeout(500 * time.Millisecond).Element(".no_results--header")
 	if err == nil {
 		return 0, nil
 	}
 
 	rc, err := page.Timeout(500 * time.Millisecond).Element("#results_count")
 	if err != nil {
-		return -1, fmt.Errorf("failed to retrieve candidate count: %w", err)
+		return -1, &FetchError{Kind: elementErrorKind(err), Err: fmt.Errorf("failed to retrieve candidate count: %w", err)}
 	}
 
 	rcStr, err := rc.Text()
 	if err != nil {
-		return -1, fmt.Errorf("failed fetch candidate count: %w", err)
+		return -1, &FetchError{Kind: ErrorKindMissingElement, Err: fmt.Errorf("failed fetch candidate count: %w", err)}
 	}
 
 	count, err := strconv.Atoi(rcStr)
 	if err != nil {
-		return -1, fmt.Errorf("failed to parse count as integer: %w", err)
+		return -1, &FetchError{Kind: ErrorKindUnparsable, Err: fmt.Errorf("failed to parse count as integer: %w", err)}
 	}
 
 	return count, nil
 }
 
 // RoleTitle reports the title of the specified roleId
-func (g *Greenhouse) RoleTitle(roleId int64) (string, error) {
-	page, err := g.getCandidatesPage(roleId, map[string]string{})
+func (g *Greenhouse) RoleTitle(ctx context.Context, roleId int64) (string, error) {
+	page, err := g.getCandidatesPage(ctx, roleId, Query{})
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch candidate page for role %d: %w", roleId, err)
 	}
-	defer page.MustClose()
+	defer closePage(page)
 
 	el, err := page.Element(".nav-title")
 	if err != nil {
-		return "", fmt.Errorf("failed to retrieve title for role %d from candidate page: %w", roleId, err)
+		err = &FetchError{Kind: elementErrorKind(err), Err: fmt.Errorf("failed to retrieve title for role %d from candidate page: %w", roleId, err)}
+		g.captureFailure(page, roleId, map[string]string{}, err)
+		return "", err
 	}
 
 	text, err := el.Text()
 	if err != nil {
-		return "", fmt.Errorf("failed to parse text from role title element: %w", err)
+		err = &FetchError{Kind: ErrorKindMissingElement, Err: fmt.Errorf("failed to parse text from role title element: %w", err)}
+		g.captureFailure(page, roleId, map[string]string{}, err)
+		return "", err
 	}
 
 	return text, nil
 }
 
-// Login is used to login to Greenhouse through the Ubuntu One SSO page
-func (g *Greenhouse) Login() error {
-	page, err := g.ghb.browser.Page(proto.TargetCreateTarget{URL: "https://canonical.greenhouse.io"})
+// Login ensures there is an active Greenhouse session. If Greenhouse redirects
+// to the login page of the login provider, the configured Authenticator is used
+// to log in, and the resulting session cookies are saved.
+func (g *Greenhouse) Login(ctx context.Context) error {
+	// No session is required when replaying recorded pages
+	if len(g.opts.ReplayDir) > 0 {
+		return nil
+	}
+
+	page, loggedIn, err := g.openHome(ctx)
+	if err != nil {
+		return err
+	}
+	defer closePage(page)
+
+	if loggedIn {
+		return nil
+	}
+
+	account, err := g.auth.Authenticate(ctx, page)
+	if err != nil {
+		return err
+	}
+
+	// Ensure that the login flow didn't end up back at the login page
+	loggedIn, err = g.loggedIn(page)
+	if err != nil {
+		return err
+	}
+	if !loggedIn {
+		return fmt.Errorf("%w, login was unsuccessful", ErrNoSession)
+	}
+
+	// Save cookies to avoid having to do the login flow as often.
+	// This is non-critical, so log an error if this fails, but don't
+	// return one, which would cancel the task.
+	err = g.ghb.SaveCookies(g.baseUrl.Host, account)
+	if err != nil {
+		slog.Debug("failed to save cookies cookies", "error", err.Error())
+	}
+
+	return nil
+}
+
+// openHome opens the Greenhouse home page, and reports whether it was shown
+// rather than the login page of the login provider
+func (g *Greenhouse) openHome(ctx context.Context) (*rod.Page, bool, error) {
+	page, err := g.ghb.browser.Context(ctx).Page(proto.TargetCreateTarget{URL: g.baseUrl.String()})
 	if err != nil {
-		return fmt.Errorf("failed to open url 'https://canonical.greenhouse.io': %w", err)
+		return nil, false, fmt.Errorf("failed to open url '%s': %w", g.baseUrl.String(), err)
 	}
-	defer page.MustClose()
 
 	// Wait for the page to settle
 	err = page.WaitStable(300 * time.Millisecond)
 	if err != nil {
-		return fmt.Errorf("failed to check login status: %w", err)
+		closePage(page)
+		return nil, false, &FetchError{Kind: ErrorKindTimeout, Err: fmt.Errorf("failed to check login status: %w", err)}
+	}
+
+	loggedIn, err := g.loggedIn(page)
+	if err != nil {
+		closePage(page)
+		return nil, false, err
 	}
 
+	return page, loggedIn, nil
+}
+
+// loggedIn reports whether a page shows Greenhouse, rather than having been
+// redirected to the login page of the login provider
+func (g *Greenhouse) loggedIn(page *rod.Page) (bool, error) {
 	info, err := page.Info()
 	if err != nil {
-		return fmt.Errorf("failed to retrieve page information: %w", err)
+		return false, fmt.Errorf("failed to retrieve page information: %w", err)
 	}
+	return !g.isLoginPage(info.URL), nil
+}
 
-	// If redirected to the Ubuntu One login, handle the login correctly
-	if info.URL == "https://login.ubuntu.com/+login?next=%2Fsaml%2Fprocess" {
-		login := os.Getenv("U1_LOGIN")
-		if len(login) == 0 {
-			prompt := promptui.Prompt{Label: "Ubuntu One Login"}
-			login, err = prompt.Run()
-			if err != nil {
-				return fmt.Errorf("failed to read login: %w", err)
-			}
-		}
+// getCandidatesPage is a helper method to construct and fetch the Candidates listing
+// page for a given role, with a specified set of URL query parameters
+func (g *Greenhouse) getCandidatesPage(ctx context.Context, roleId int64, query Query) (*rod.Page, error) {
+	if len(g.opts.ReplayDir) > 0 {
+		return g.getReplayedPage(ctx, roleId, query)
+	}
 
-		password := os.Getenv("U1_PASSWORD")
-		if len(password) == 0 {
-			prompt := promptui.Prompt{
-				Label: "Ubuntu One Password",
-				Mask:  '*',
-			}
-			password, err = prompt.Run()
-			if err != nil {
-				return fmt.Errorf("failed to read password: %w", err)
-			}
-		}
+	pageUrl := g.CandidatesURL(roleId, query.Values)
 
-		page.MustElement(`#id_email`).MustInput(login)
-		page.MustElement(`#id_password`).MustInput(password)
-		page.MustElement("[type=submit]").MustClick()
+	page, err := g.ghb.browser.Context(ctx).Page(proto.TargetCreateTarget{URL: pageUrl.String()})
+	if err != nil {
+		return nil, &FetchError{Kind: ErrorKindNavigation, Err: fmt.Errorf("failed to load page '%s': %w", pageUrl.String(), err)}
+	}
 
-		err = page.WaitStable(300 * time.Millisecond)
-		if err != nil {
-			return fmt.Errorf("failed to check login status: %w", err)
-		}
+	err = page.WaitStable(300 * time.Millisecond)
+	if err != nil {
+		g.captureFailure(page, roleId, query.Values, err)
+		closePage(page)
+		return nil, &FetchError{Kind: ErrorKindTimeout, Err: fmt.Errorf("failed to wait for page '%s' to load: %w", pageUrl.String(), err)}
+	}
 
-		prompt := promptui.Prompt{Label: "Ubuntu One OTP"}
-		otp, err := prompt.Run()
+	// If the session has expired, Greenhouse redirects to the login page
+	loggedIn, err := g.loggedIn(page)
+	if err != nil || !loggedIn {
+		closePage(page)
 		if err != nil {
-			return fmt.Errorf("failed to read otp: %w", err)
+			return nil, err
 		}
+		return nil, fmt.Errorf("%w, redirected to the login page", ErrSessionExpired)
+	}
 
-		page.MustElement(`#id_oath_token`).MustInput(otp)
-		page.MustElement("[type=submit]").MustClick()
-
-		err = page.WaitStable(300 * time.Millisecond)
+	if len(g.opts.RecordDir) > 0 {
+		html, err := page.HTML()
 		if err != nil {
-			return fmt.Errorf("failed to check login status: %w", err)
+			closePage(page)
+			return nil, fmt.Errorf("failed to read page html for recording: %w", err)
 		}
 
-		// Save cookies to avoid having to do the login flow as often.
-		// This is non-critical, so log an error if this fails, but don't
-		// return one, which would cancel the task.
-		err = g.ghb.SaveCookies()
+		keyed := recordingQueries(query)
+		err = recordPage(g.opts.RecordDir, roleId, keyed, pageUrl.String(), html)
 		if err != nil {
-			slog.Debug("failed to save cookies cookies", "error", err.Error())
+			closePage(page)
+			return nil, err
 		}
+		slog.Debug("recorded candidates page", "role", roleId, "key", pageKey(roleId, keyed))
 	}
 
-	return nil
+	return page, nil
 }
 
-// getCandidatesPage is a helper method to construct and fetch the Candidates listing
-// page for a given role, with a specified set of URL query parameters
-func (g *Greenhouse) getCandidatesPage(roleId int64, queries map[string]string) (*rod.Page, error) {
-	pageUrl := url.URL{}
-	pageUrl.Scheme = "https"
-	pageUrl.Host = "canonical.greenhouse.io"
-	pageUrl.Path = fmt.Sprintf("plans/%d/candidates", roleId)
+// CandidatesURL returns the address of the candidates page for a role, filtered
+// with the specified query parameters
+func (g *Greenhouse) CandidatesURL(roleId int64, queries map[string]string) *url.URL {
+	return CandidatesURL(g.baseUrl, roleId, queries)
+}
+
+// ParseBaseURL parses the address of a Greenhouse instance, defaulting to
+// DefaultBaseURL if none is specified
+func ParseBaseURL(s string) (*url.URL, error) {
+	if len(s) == 0 {
+		s = DefaultBaseURL
+	}
+
+	baseUrl, err := url.Parse(strings.TrimSuffix(s, "/"))
+	if err != nil || len(baseUrl.Scheme) == 0 || len(baseUrl.Host) == 0 {
+		return nil, fmt.Errorf("invalid greenhouse url '%s'", s)
+	}
+	return baseUrl, nil
+}
 
-	fields := pageUrl.Query()
+// CandidatesURL returns the address of the candidates page for a role on the
+// Greenhouse instance at baseUrl, filtered with the specified query parameters
+func CandidatesURL(baseUrl *url.URL, roleId int64, queries map[string]string) *url.URL {
+	pageUrl := *baseUrl
+	pageUrl.Path = fmt.Sprintf("%s/plans/%d/candidates", baseUrl.Path, roleId)
+
+	fields := url.Values{}
 	fields.Add("hiring_plan_id[]", fmt.Sprintf("%d", roleId))
 	fields.Add("job_status", "open")
 	fields.Add("stage_status_id[]", "2")
@@ -191,13 +400,96 @@ func (g *Greenhouse) getCandidatesPage(roleId int64, queries map[string]string)
 	}
 
 	pageUrl.RawQuery = fields.Encode()
+	return &pageUrl
+}
 
-	page, err := g.ghb.browser.Page(proto.TargetCreateTarget{URL: pageUrl.String()})
+// isLoginPage reports whether a URL is that of the login page of the login
+// provider, which Greenhouse redirects to when there is no active session
+func (g *Greenhouse) isLoginPage(pageUrl string) bool {
+	for _, re := range g.loginUrls {
+		if re.MatchString(pageUrl) {
+			return true
+		}
+	}
+	return false
+}
+
+// getReplayedPage loads a candidates page saved in record mode into a new
+// browser page. The page is taken offline and scripts are disabled, so that the
+// saved DOM is inspected exactly as it was recorded.
+func (g *Greenhouse) getReplayedPage(ctx context.Context, roleId int64, query Query) (*rod.Page, error) {
+	html, err := replayPage(g.opts.ReplayDir, roleId, recordingQueries(query))
 	if err != nil {
-		return nil, fmt.Errorf("failed to load page '%s': %w", pageUrl.String(), err)
+		return nil, err
 	}
 
-	err = page.WaitStable(300 * time.Millisecond)
+	page, err := g.ghb.browser.Context(ctx).Page(proto.TargetCreateTarget{URL: "about:blank"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blank page: %w", err)
+	}
+
+	err = proto.NetworkEmulateNetworkConditions{Offline: true}.Call(page)
+	if err != nil {
+		closePage(page)
+		return nil, fmt.Errorf("failed to disable network for replayed page: %w", err)
+	}
+
+	err = proto.EmulationSetScriptExecutionDisabled{Value: true}.Call(page)
+	if err != nil {
+		closePage(page)
+		return nil, fmt.Errorf("failed to disable scripts for replayed page: %w", err)
+	}
+
+	err = page.SetDocumentContent(html)
+	if err != nil {
+		closePage(page)
+		return nil, fmt.Errorf("failed to load replayed page for role %d: %w", roleId, err)
+	}
+
+	return page, nil
+}
+
+// Close shuts down the browser used to interact with Greenhouse, and cleans up
+// any temporary files it created
+func (g *Greenhouse) Close() error {
+	return g.ghb.Close()
+}
+
+// closePage closes a page, even if the context it was opened with has since
+// been cancelled
+func closePage(page *rod.Page) {
+	err := page.Context(context.Background()).Close()
+	if err != nil {
+		slog.Debug("failed to close page", "error", err.Error())
+	}
+}
 
-	return page, err
+// inputText types the specified text into the element matching a selector
+func inputText(page *rod.Page, selector, text string) error {
+	el, err := page.Element(selector)
+	if err != nil {
+		return fmt.Errorf("failed to find element '%s': %w", selector, err)
+	}
+
+	err = el.Input(text)
+	if err != nil {
+		return fmt.Errorf("failed to input text into element '%s': %w", selector, err)
+	}
+
+	return nil
+}
+
+// clickElement clicks the element matching a selector
+func clickElement(page *rod.Page, selector string) error {
+	el, err := page.Element(selector)
+	if err != nil {
+		return fmt.Errorf("failed to find element '%s': %w", selector, err)
+	}
+
+	err = el.Click(proto.InputMouseButtonLeft, 1)
+	if err != nil {
+		return fmt.Errorf("failed to click element '%s': %w", selector, err)
+	}
+
+	return nil
 }
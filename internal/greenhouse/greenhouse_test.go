@@ -0,0 +1,140 @@
+package greenhouse
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestNewGreenhouseDefaults(t *testing.T) {
+	g, err := newGreenhouse(Options{})
+	if err != nil {
+		t.Fatalf("failed to construct greenhouse client: %s", err.Error())
+	}
+
+	if g.baseUrl.String() != DefaultBaseURL {
+		t.Errorf("incorrect default base url, expected '%s', got '%s'", DefaultBaseURL, g.baseUrl.String())
+	}
+
+	if !g.isLoginPage("https://login.ubuntu.com/+login?next=%2Fsaml%2Fprocess") {
+		t.Errorf("expected the ubuntu one login page to be detected by default")
+	}
+
+	if g.isLoginPage("https://canonical.greenhouse.io/dashboard") {
+		t.Errorf("greenhouse page incorrectly detected as a login page")
+	}
+}
+
+func TestNewGreenhouseInvalidOptions(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"record and replay": {RecordDir: "a", ReplayDir: "b"},
+		"relative url":      {BaseURL: "greenhouse.example.com"},
+		"unknown provider":  {LoginProvider: "foobar"},
+		"invalid pattern":   {LoginURLPatterns: []string{"(unclosed"}},
+	} {
+		if _, err := newGreenhouse(opts); err == nil {
+			t.Errorf("expected an error constructing a client with %s", name)
+		}
+	}
+}
+
+func TestLoginURLPatterns(t *testing.T) {
+	g, err := newGreenhouse(Options{
+		BaseURL:          "https://example.greenhouse.io",
+		LoginURLPatterns: []string{`^https://sso\.example\.com/`, `/saml/login`},
+	})
+	if err != nil {
+		t.Fatalf("failed to construct greenhouse client: %s", err.Error())
+	}
+
+	for url, expected := range map[string]bool{
+		"https://sso.example.com/login?next=/":    true,
+		"https://auth.example.com/saml/login?x=y": true,
+		"https://login.ubuntu.com/+login":         false,
+		"https://example.greenhouse.io/dashboard": false,
+	} {
+		if g.isLoginPage(url) != expected {
+			t.Errorf("incorrect login page detection for '%s', expected %t", url, expected)
+		}
+	}
+}
+
+func TestCandidatesURL(t *testing.T) {
+	g, err := newGreenhouse(Options{BaseURL: "http://127.0.0.1:8080/tenant/"})
+	if err != nil {
+		t.Fatalf("failed to construct greenhouse client: %s", err.Error())
+	}
+
+	u := g.CandidatesURL(1234, map[string]string{"in_stages[]": "Application Review"})
+
+	expected := "http://127.0.0.1:8080/tenant/plans/1234/candidates?hiring_plan_id%5B%5D=1234&in_stages%5B%5D=Application+Review&job_status=open&stage_status_id%5B%5D=2&type=all"
+	if u.String() != expected {
+		t.Errorf("incorrect candidates url, expected '%s', got '%s'", expected, u.String())
+	}
+}
+
+func TestGreenhouseFakeServer(t *testing.T) {
+	if _, err := findBrowser(); err != nil {
+		t.Skip("no browser available to launch")
+	}
+
+	srv := httptest.NewServer(fakeGreenhouseHandler())
+	t.Cleanup(srv.Close)
+
+	g, err := newGreenhouse(Options{
+		BaseURL:          srv.URL,
+		LoginURLPatterns: []string{"^" + regexp.QuoteMeta(srv.URL) + "/sso/"},
+	})
+	if err != nil {
+		t.Fatalf("failed to construct greenhouse client: %s", err.Error())
+	}
+
+	g.ghb = &ghstatBrowser{}
+	if err := g.ghb.Init(); err != nil {
+		t.Fatalf("failed to initialise browser: %s", err.Error())
+	}
+	defer g.Close()
+
+	// The fake server has no login, so no login should be attempted
+	if err := g.Login(context.Background()); err != nil {
+		t.Fatalf("unexpected error logging in to fake server: %s", err.Error())
+	}
+
+	title, err := g.RoleTitle(context.Background(), 100)
+	if err != nil || title != "Software Engineer" {
+		t.Errorf("incorrect role title from fake server, got '%s' (%v)", title, err)
+	}
+
+	count, err := g.CandidateCount(context.Background(), 100, Query{Values: FilterSet{"in_stages[]": "Hold"}})
+	if err != nil || count != 3 {
+		t.Errorf("incorrect candidate count from fake server, expected 3, got %d (%v)", count, err)
+	}
+
+	count, err = g.CandidateCount(context.Background(), 100, Query{Values: FilterSet{"in_stages[]": "Offer"}})
+	if err != nil || count != 0 {
+		t.Errorf("incorrect candidate count from fake server, expected 0, got %d (%v)", count, err)
+	}
+}
+
+// fakeGreenhouseHandler serves a minimal imitation of the Greenhouse candidates
+// page, listing three candidates on hold for role 100
+func fakeGreenhouseHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>Dashboard</body></html>")
+	})
+
+	mux.HandleFunc("/plans/100/candidates", func(w http.ResponseWriter, r *http.Request) {
+		results := `<span id="results_count">3</span>`
+		if r.URL.Query().Get("in_stages[]") != "Hold" {
+			results = `<div class="no_results--header">No results</div>`
+		}
+		fmt.Fprintf(w, `<html><body><span class="nav-title">Software Engineer</span>%s</body></html>`, results)
+	})
+
+	return mux
+}
@@ -0,0 +1,449 @@
+package greenhouse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHarvestURL is the base URL of the Greenhouse Harvest API
+const DefaultHarvestURL = "https://harvest.greenhouse.io/v1"
+
+// Harvest is a GreenhouseClient which gathers statistics using the Greenhouse
+// Harvest REST API, rather than by scraping the Greenhouse web interface.
+//
+// Candidate counts are computed by fetching the active applications for a
+// role, and evaluating each of the query parameters that would be sent to the
+// candidates page against the application, stage and activity data.
+type Harvest struct {
+	baseUrl string
+	webUrl  string
+	apiKey  string
+	client  *http.Client
+
+	mu           sync.Mutex
+	applications map[int64][]*harvestApplication
+	stages       map[int64][]*harvestStage
+	interviews   map[int64][]*harvestScheduledInterview
+	scorecards   map[int64][]*harvestScorecard
+}
+
+// NewHarvest constructs a new Harvest client for the API at the specified URL,
+// authenticating with the specified API key. Links to candidates point at the
+// Greenhouse instance at webUrl.
+func NewHarvest(baseUrl, apiKey, webUrl string) *Harvest {
+	if len(baseUrl) == 0 {
+		baseUrl = DefaultHarvestURL
+	}
+
+	if len(webUrl) == 0 {
+		webUrl = DefaultBaseURL
+	}
+
+	return &Harvest{
+		baseUrl:      strings.TrimSuffix(baseUrl, "/"),
+		webUrl:       strings.TrimSuffix(webUrl, "/"),
+		apiKey:       apiKey,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		applications: make(map[int64][]*harvestApplication),
+		stages:       make(map[int64][]*harvestStage),
+		interviews:   make(map[int64][]*harvestScheduledInterview),
+		scorecards:   make(map[int64][]*harvestScorecard),
+	}
+}
+
+// harvestJob is the subset of a Harvest job used by ghstat
+type harvestJob struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// harvestApplication is the subset of a Harvest application used by ghstat
+type harvestApplication struct {
+	ID             int64     `json:"id"`
+	CandidateID    int64     `json:"candidate_id"`
+	Status         string    `json:"status"`
+	LastActivityAt time.Time `json:"last_activity_at"`
+	CurrentStage   *struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	} `json:"current_stage"`
+	Attachments []harvestAttachment `json:"attachments"`
+}
+
+// harvestCandidate is the subset of a Harvest candidate used by ghstat
+type harvestCandidate struct {
+	ID        int64  `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// harvestAttachment is the subset of a Harvest application attachment used by ghstat
+type harvestAttachment struct {
+	Type string `json:"type"`
+}
+
+// harvestStage is the subset of a Harvest job stage used by ghstat
+type harvestStage struct {
+	ID         int64                   `json:"id"`
+	Name       string                  `json:"name"`
+	Interviews []harvestStageInterview `json:"interviews"`
+}
+
+// harvestStageInterview is the subset of an interview step in a Harvest job
+// stage used by ghstat
+type harvestStageInterview struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Schedulable bool   `json:"schedulable"`
+}
+
+// harvestScheduledInterview is the subset of a Harvest scheduled interview
+// used by ghstat
+type harvestScheduledInterview struct {
+	ID        int64  `json:"id"`
+	Status    string `json:"status"`
+	Interview struct {
+		ID int64 `json:"id"`
+	} `json:"interview"`
+	Interviewers []harvestInterviewer `json:"interviewers"`
+}
+
+// harvestInterviewer is the subset of a scheduled interview's interviewer used by ghstat
+type harvestInterviewer struct {
+	ScorecardID *int64 `json:"scorecard_id"`
+}
+
+// harvestScorecard is the subset of a Harvest scorecard used by ghstat
+type harvestScorecard struct {
+	ID            int64      `json:"id"`
+	SubmittedAt   *time.Time `json:"submitted_at"`
+	InterviewStep struct {
+		ID int64 `json:"id"`
+	} `json:"interview_step"`
+}
+
+// RoleTitle reports the title of the specified roleId
+func (h *Harvest) RoleTitle(ctx context.Context, roleId int64) (string, error) {
+	job := &harvestJob{}
+
+	err := h.get(ctx, fmt.Sprintf("/jobs/%d", roleId), nil, job)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch job for role %d: %w", roleId, err)
+	}
+
+	return job.Name, nil
+}
+
+// CandidateCount reports the number of active applications for the role which
+// match all of the specified query parameters
+func (h *Harvest) CandidateCount(ctx context.Context, roleId int64, query Query) (int, error) {
+	apps, err := h.matchingApplications(ctx, roleId, query.Values)
+	if err != nil {
+		return -1, err
+	}
+	return len(apps), nil
+}
+
+// Candidates lists the candidates with active applications for the role which
+// match all of the specified query parameters
+func (h *Harvest) Candidates(ctx context.Context, roleId int64, query Query) ([]Candidate, error) {
+	apps, err := h.matchingApplications(ctx, roleId, query.Values)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []int64{}
+	for _, app := range apps {
+		ids = append(ids, app.CandidateID)
+	}
+
+	people, err := h.candidates(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []Candidate{}
+	for _, app := range apps {
+		hc, ok := people[app.CandidateID]
+		if !ok {
+			return nil, fmt.Errorf("failed to fetch candidate %d", app.CandidateID)
+		}
+
+		c := Candidate{
+			ID:           hc.ID,
+			Name:         strings.TrimSpace(hc.FirstName + " " + hc.LastName),
+			LastActivity: app.LastActivityAt.Local().Format(time.DateOnly),
+			URL:          fmt.Sprintf("%s/people/%d?application_id=%d", h.webUrl, hc.ID, app.ID),
+		}
+
+		if app.CurrentStage != nil {
+			c.Stage = app.CurrentStage.Name
+		}
+
+		candidates = append(candidates, c)
+	}
+
+	return candidates, nil
+}
+
+// harvestCandidateBatch is the largest number of candidates Harvest returns
+// for a single request filtered by candidate ID
+const harvestCandidateBatch = 50
+
+// candidates fetches the candidates with the specified IDs in batches, rather
+// than requesting each candidate individually, to stay within the Harvest rate
+// limit
+func (h *Harvest) candidates(ctx context.Context, ids []int64) (map[int64]*harvestCandidate, error) {
+	people := map[int64]*harvestCandidate{}
+
+	for batch := range slices.Chunk(ids, harvestCandidateBatch) {
+		strs := []string{}
+		for _, id := range batch {
+			strs = append(strs, strconv.FormatInt(id, 10))
+		}
+
+		params := url.Values{}
+		params.Add("candidate_ids", strings.Join(strs, ","))
+
+		page, err := harvestList[*harvestCandidate](ctx, h, "/candidates", params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch candidates: %w", err)
+		}
+
+		for _, hc := range page {
+			people[hc.ID] = hc
+		}
+	}
+
+	return people, nil
+}
+
+// matchingApplications returns the active applications for the role which
+// match all of the specified query parameters
+func (h *Harvest) matchingApplications(ctx context.Context, roleId int64, queries map[string]string) ([]*harvestApplication, error) {
+	for k := range queries {
+		if _, ok := harvestPredicates[k]; !ok {
+			return nil, fmt.Errorf("query parameter '%s' is not supported by the harvest backend", k)
+		}
+	}
+
+	apps, err := h.roleApplications(ctx, roleId)
+	if err != nil {
+		return nil, err
+	}
+
+	matching := []*harvestApplication{}
+	for _, app := range apps {
+		matched, err := h.matches(ctx, roleId, app, queries)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			matching = append(matching, app)
+		}
+	}
+
+	return matching, nil
+}
+
+// Login ensures that an API key has been provided. The Harvest API is
+// stateless, so there is no session to establish.
+func (h *Harvest) Login(ctx context.Context) error {
+	if len(h.apiKey) == 0 {
+		return errors.New("no harvest api key specified, set GREENHOUSE_API_KEY or 'harvest.apiKey' in the config")
+	}
+	return nil
+}
+
+// Reset discards the cached applications, stages, interviews and scorecards,
+// so that they are fetched again when next needed
+func (h *Harvest) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	clear(h.applications)
+	clear(h.stages)
+	clear(h.interviews)
+	clear(h.scorecards)
+}
+
+// Close releases any idle connections to the Harvest API
+func (h *Harvest) Close() error {
+	h.client.CloseIdleConnections()
+	return nil
+}
+
+// roleApplications fetches (and caches) the active applications for a role
+func (h *Harvest) roleApplications(ctx context.Context, roleId int64) ([]*harvestApplication, error) {
+	h.mu.Lock()
+	apps, ok := h.applications[roleId]
+	h.mu.Unlock()
+	if ok {
+		return apps, nil
+	}
+
+	params := url.Values{}
+	params.Add("job_id", fmt.Sprintf("%d", roleId))
+	params.Add("status", "active")
+
+	apps, err := harvestList[*harvestApplication](ctx, h, "/applications", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch applications for role %d: %w", roleId, err)
+	}
+
+	h.mu.Lock()
+	h.applications[roleId] = apps
+	h.mu.Unlock()
+
+	slog.Debug("fetched applications from harvest", "role", roleId, "count", len(apps))
+	return apps, nil
+}
+
+// roleStages fetches (and caches) the interview plan stages for a role
+func (h *Harvest) roleStages(ctx context.Context, roleId int64) ([]*harvestStage, error) {
+	h.mu.Lock()
+	stages, ok := h.stages[roleId]
+	h.mu.Unlock()
+	if ok {
+		return stages, nil
+	}
+
+	stages, err := harvestList[*harvestStage](ctx, h, fmt.Sprintf("/jobs/%d/stages", roleId), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch stages for role %d: %w", roleId, err)
+	}
+
+	h.mu.Lock()
+	h.stages[roleId] = stages
+	h.mu.Unlock()
+
+	return stages, nil
+}
+
+// scheduledInterviews fetches (and caches) the scheduled interviews for an application
+func (h *Harvest) scheduledInterviews(ctx context.Context, appId int64) ([]*harvestScheduledInterview, error) {
+	h.mu.Lock()
+	interviews, ok := h.interviews[appId]
+	h.mu.Unlock()
+	if ok {
+		return interviews, nil
+	}
+
+	interviews, err := harvestList[*harvestScheduledInterview](ctx, h, fmt.Sprintf("/applications/%d/scheduled_interviews", appId), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch scheduled interviews for application %d: %w", appId, err)
+	}
+
+	h.mu.Lock()
+	h.interviews[appId] = interviews
+	h.mu.Unlock()
+
+	return interviews, nil
+}
+
+// applicationScorecards fetches (and caches) the scorecards for an application
+func (h *Harvest) applicationScorecards(ctx context.Context, appId int64) ([]*harvestScorecard, error) {
+	h.mu.Lock()
+	scorecards, ok := h.scorecards[appId]
+	h.mu.Unlock()
+	if ok {
+		return scorecards, nil
+	}
+
+	scorecards, err := harvestList[*harvestScorecard](ctx, h, fmt.Sprintf("/applications/%d/scorecards", appId), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch scorecards for application %d: %w", appId, err)
+	}
+
+	h.mu.Lock()
+	h.scorecards[appId] = scorecards
+	h.mu.Unlock()
+
+	return scorecards, nil
+}
+
+// linkNextRegexp matches the 'next' relation in a Harvest pagination Link header
+var linkNextRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// harvestList fetches every page of a paginated Harvest list endpoint and
+// returns the combined results
+func harvestList[T any](ctx context.Context, h *Harvest, path string, params url.Values) ([]T, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("per_page", "500")
+
+	items := []T{}
+	next := fmt.Sprintf("%s%s?%s", h.baseUrl, path, params.Encode())
+
+	for len(next) > 0 {
+		page := []T{}
+
+		header, err := h.fetch(ctx, next, &page)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, page...)
+
+		next = ""
+		if m := linkNextRegexp.FindStringSubmatch(header.Get("Link")); m != nil {
+			next = m[1]
+		}
+	}
+
+	return items, nil
+}
+
+// get fetches a single Harvest API resource and decodes it into out
+func (h *Harvest) get(ctx context.Context, path string, params url.Values, out any) error {
+	u := h.baseUrl + path
+	if len(params) > 0 {
+		u = fmt.Sprintf("%s?%s", u, params.Encode())
+	}
+
+	_, err := h.fetch(ctx, u, out)
+	return err
+}
+
+// fetch performs an authenticated GET request against the Harvest API and
+// decodes the JSON response into out
+func (h *Harvest) fetch(ctx context.Context, u string, out any) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct request for '%s': %w", u, err)
+	}
+	req.SetBasicAuth(h.apiKey, "")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, &FetchError{Kind: ErrorKindNavigation, Err: fmt.Errorf("failed to request '%s': %w", u, err)}
+	}
+	defer resp.Body.Close()
+
+	// Rate limiting and server errors may succeed if retried
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, &FetchError{Kind: ErrorKindNavigation, Err: fmt.Errorf("unexpected response from '%s': %s", u, resp.Status)}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from '%s': %s", u, resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response from '%s': %w", u, err)
+	}
+
+	return resp.Header, nil
+}
@@ -0,0 +1,224 @@
+package greenhouse
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+// harvestPredicate reports whether an application matches the value of a given
+// candidates page query parameter
+type harvestPredicate func(ctx context.Context, h *Harvest, roleId int64, app *harvestApplication, value string) (bool, error)
+
+// harvestPredicates maps the query parameters understood by the Greenhouse
+// candidates page onto equivalent checks against Harvest API data
+var harvestPredicates = map[string]harvestPredicate{
+	"in_stages[]":                harvestInStage,
+	"stage_status_id[]":          harvestStageStatus,
+	"last_activity_end":          harvestLastActivityEnd,
+	"needs_decision":             harvestNeedsDecision,
+	"interview_status_id[]":      harvestInterviewStatus,
+	"take_home_test_status_id[]": harvestTakeHomeTestStatus,
+}
+
+// ValidateHarvestMetrics ensures that every query parameter of the metrics
+// can be evaluated against Harvest API data, so that a metric which the
+// harvest backend can't count is reported before any statistics are gathered.
+// Candidate availability is not exposed by the Harvest API, so metrics which
+// filter on 'availability_state' are rejected.
+func ValidateHarvestMetrics(metrics []Metric) error {
+	for _, m := range metrics {
+		for _, k := range slices.Sorted(maps.Keys(m.Query)) {
+			if _, ok := harvestPredicates[k]; !ok {
+				return fmt.Errorf("metric '%s' uses query parameter '%s', which is not supported by the harvest backend", m.Key, k)
+			}
+		}
+	}
+
+	return nil
+}
+
+// matches reports whether an application matches all of the specified queries.
+// Each query parameter must have an entry in harvestPredicates.
+func (h *Harvest) matches(ctx context.Context, roleId int64, app *harvestApplication, queries map[string]string) (bool, error) {
+	for k, v := range queries {
+		matched, err := harvestPredicates[k](ctx, h, roleId, app, v)
+		if err != nil {
+			return false, err
+		}
+
+		if !matched {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// harvestInStage matches applications whose current stage has the specified name
+func harvestInStage(ctx context.Context, h *Harvest, roleId int64, app *harvestApplication, value string) (bool, error) {
+	return app.CurrentStage != nil && app.CurrentStage.Name == value, nil
+}
+
+// harvestStageStatus matches applications that are active in their current
+// stage. Only active applications are fetched, so only the 'active' status (2)
+// is supported.
+func harvestStageStatus(ctx context.Context, h *Harvest, roleId int64, app *harvestApplication, value string) (bool, error) {
+	if value != "2" {
+		return false, fmt.Errorf("stage status '%s' is not supported by the harvest backend", value)
+	}
+	return app.Status == "active", nil
+}
+
+// harvestLastActivityEnd matches applications with no activity after the
+// specified date, which is given in the format 'YYYY/MM/DD'
+func harvestLastActivityEnd(ctx context.Context, h *Harvest, roleId int64, app *harvestApplication, value string) (bool, error) {
+	end, err := time.ParseInLocation("2006/01/02", value, time.Local)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse last activity date '%s': %w", value, err)
+	}
+
+	return app.LastActivityAt.Before(end.AddDate(0, 0, 1)), nil
+}
+
+// harvestNeedsDecision matches applications where every schedulable interview
+// in the current stage has been completed, with all of its scorecards submitted
+func harvestNeedsDecision(ctx context.Context, h *Harvest, roleId int64, app *harvestApplication, value string) (bool, error) {
+	if value != "1" {
+		return false, fmt.Errorf("needs decision value '%s' is not supported by the harvest backend", value)
+	}
+
+	stageInterviews, err := h.currentStageInterviews(ctx, roleId, app)
+	if err != nil {
+		return false, err
+	}
+
+	stageInterviews = slices.DeleteFunc(stageInterviews, func(i harvestStageInterview) bool {
+		return !i.Schedulable
+	})
+	if len(stageInterviews) == 0 {
+		return false, nil
+	}
+
+	interviews, err := h.scheduledInterviews(ctx, app.ID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, i := range stageInterviews {
+		complete := slices.ContainsFunc(interviews, func(si *harvestScheduledInterview) bool {
+			return si.Interview.ID == i.ID && si.scored()
+		})
+
+		if !complete {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// harvestInterviewStatus matches applications with schedulable interviews in
+// the current stage that are yet to be scheduled (status 1)
+func harvestInterviewStatus(ctx context.Context, h *Harvest, roleId int64, app *harvestApplication, value string) (bool, error) {
+	if value != "1" {
+		return false, fmt.Errorf("interview status '%s' is not supported by the harvest backend", value)
+	}
+
+	stageInterviews, err := h.currentStageInterviews(ctx, roleId, app)
+	if err != nil {
+		return false, err
+	}
+
+	stageInterviews = slices.DeleteFunc(stageInterviews, func(i harvestStageInterview) bool {
+		return !i.Schedulable
+	})
+	if len(stageInterviews) == 0 {
+		return false, nil
+	}
+
+	interviews, err := h.scheduledInterviews(ctx, app.ID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, i := range stageInterviews {
+		if !slices.ContainsFunc(interviews, func(si *harvestScheduledInterview) bool {
+			return si.Interview.ID == i.ID
+		}) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// harvestTakeHomeTestStatus matches applications that have submitted a take
+// home test which is yet to be graded in the current stage (status 9)
+func harvestTakeHomeTestStatus(ctx context.Context, h *Harvest, roleId int64, app *harvestApplication, value string) (bool, error) {
+	if value != "9" {
+		return false, fmt.Errorf("take home test status '%s' is not supported by the harvest backend", value)
+	}
+
+	submitted := slices.ContainsFunc(app.Attachments, func(a harvestAttachment) bool {
+		return a.Type == "take_home_test"
+	})
+	if !submitted {
+		return false, nil
+	}
+
+	stageInterviews, err := h.currentStageInterviews(ctx, roleId, app)
+	if err != nil {
+		return false, err
+	}
+
+	scorecards, err := h.applicationScorecards(ctx, app.ID)
+	if err != nil {
+		return false, err
+	}
+
+	graded := slices.ContainsFunc(scorecards, func(s *harvestScorecard) bool {
+		return s.SubmittedAt != nil && slices.ContainsFunc(stageInterviews, func(i harvestStageInterview) bool {
+			return i.ID == s.InterviewStep.ID
+		})
+	})
+
+	return !graded, nil
+}
+
+// scored reports whether the scheduled interview is complete, and every
+// interviewer has submitted a scorecard
+func (si *harvestScheduledInterview) scored() bool {
+	if si.Status != "complete" {
+		return false
+	}
+
+	return !slices.ContainsFunc(si.Interviewers, func(i harvestInterviewer) bool {
+		return i.ScorecardID == nil
+	})
+}
+
+// currentStageInterviews returns the interviews that make up the application's
+// current stage in the role's interview plan
+func (h *Harvest) currentStageInterviews(ctx context.Context, roleId int64, app *harvestApplication) ([]harvestStageInterview, error) {
+	if app.CurrentStage == nil {
+		return nil, nil
+	}
+
+	stages, err := h.roleStages(ctx, roleId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range stages {
+		if s.ID == app.CurrentStage.ID {
+			return slices.Clone(s.Interviews), nil
+		}
+	}
+
+	slog.Debug("current stage not found in interview plan", "role", roleId, "application", app.ID, "stage", app.CurrentStage.Name)
+	return nil, nil
+}
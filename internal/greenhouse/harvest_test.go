@@ -0,0 +1,251 @@
+package greenhouse
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHarvestRoleTitle(t *testing.T) {
+	h, _ := testHarvest(t)
+
+	title, err := h.RoleTitle(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("failed to fetch role title: %s", err.Error())
+	}
+
+	if title != "Software Engineer" {
+		t.Errorf("incorrect role title, expected 'Software Engineer', got '%s'", title)
+	}
+}
+
+func TestHarvestRoleTitleNotFound(t *testing.T) {
+	h, _ := testHarvest(t)
+
+	_, err := h.RoleTitle(context.Background(), 999)
+	if err == nil {
+		t.Errorf("expected an error fetching the title of a non-existent role")
+	}
+}
+
+func TestHarvestDefaultMetrics(t *testing.T) {
+	h, _ := testHarvest(t)
+
+	expected := map[string]int{
+		"appReviews":    2,
+		"needsDecision": 1,
+		"wiScreening":   1,
+		"wiGrading":     1,
+		"stale":         1,
+	}
+
+	for _, m := range DefaultMetrics {
+		query, err := m.Evaluate()
+		if err != nil {
+			t.Fatalf("failed to evaluate queries for metric '%s': %s", m.Key, err.Error())
+		}
+
+		count, err := h.CandidateCount(context.Background(), 100, query)
+
+		// Candidate availability can't be evaluated against Harvest API data
+		if m.Key == "needsScheduling" {
+			if err == nil {
+				t.Errorf("expected an error counting metric '%s', got %d", m.Key, count)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("failed to fetch candidate count for metric '%s': %s", m.Key, err.Error())
+		}
+
+		if count != expected[m.Key] {
+			t.Errorf("incorrect count for metric '%s', expected %d, got %d", m.Key, expected[m.Key], count)
+		}
+	}
+}
+
+func TestHarvestPopulateRole(t *testing.T) {
+	h, _ := testHarvest(t)
+
+	r := NewRole(100, "Joe Bloggs", DefaultMetrics)
+	err := r.Populate(context.Background(), h, func(a int64) {})
+	if err != nil {
+		t.Fatalf("failed to populate role: %s", err.Error())
+	}
+
+	if r.Title != "Software Engineer" || r.Value("appReviews") != 2 {
+		t.Errorf("role populated incorrectly from harvest: %s, %d", r.Title, r.Value("appReviews"))
+	}
+}
+
+func TestHarvestCandidates(t *testing.T) {
+	h, requests := testHarvest(t)
+
+	candidates, err := h.Candidates(context.Background(), 100, Query{Values: FilterSet{"in_stages[]": "Hold"}})
+	if err != nil {
+		t.Fatalf("failed to list candidates: %s", err.Error())
+	}
+
+	if len(candidates) != 2 {
+		t.Fatalf("expected 2 candidates in 'Hold', got %d", len(candidates))
+	}
+
+	c := candidates[0]
+	if c.ID != 104 || c.Name != "Candidate 104" || c.Stage != "Hold" {
+		t.Errorf("candidate listed incorrectly: %+v", c)
+	}
+
+	if c.URL != "https://canonical.greenhouse.io/people/104?application_id=4" {
+		t.Errorf("incorrect candidate link: %s", c.URL)
+	}
+
+	if c.LastActivity != time.Now().Format(time.DateOnly) {
+		t.Errorf("incorrect last activity for candidate, got '%s'", c.LastActivity)
+	}
+
+	// Candidates are fetched together, rather than with a request each
+	for path, n := range requests {
+		if strings.HasPrefix(path, "/v1/candidates/") || (path == "/v1/candidates" && n != 1) {
+			t.Errorf("expected candidates to be fetched in a single request, got %v", requests)
+		}
+	}
+}
+
+func TestHarvestCachesApplications(t *testing.T) {
+	h, requests := testHarvest(t)
+
+	for range 3 {
+		_, err := h.CandidateCount(context.Background(), 100, Query{Values: FilterSet{"in_stages[]": "Hold"}})
+		if err != nil {
+			t.Fatalf("failed to fetch candidate count: %s", err.Error())
+		}
+	}
+
+	// Two pages of applications should be fetched exactly once
+	if n := requests["/v1/applications"]; n != 2 {
+		t.Errorf("expected applications to be fetched from 2 pages once, got %d requests", n)
+	}
+}
+
+func TestHarvestUnsupportedQuery(t *testing.T) {
+	h, _ := testHarvest(t)
+
+	_, err := h.CandidateCount(context.Background(), 100, Query{Values: FilterSet{"in_stages[]": "Hold", "source_id": "1"}})
+	if err == nil {
+		t.Errorf("expected an error for a query parameter unsupported by harvest")
+	}
+}
+
+func TestValidateHarvestMetrics(t *testing.T) {
+	supported := []Metric{{Key: "held", Query: FilterSet{"in_stages[]": "Hold", "last_activity_end": "{{ daysAgo 7 }}"}}}
+	if err := ValidateHarvestMetrics(supported); err != nil {
+		t.Errorf("expected supported metrics to be valid, got %s", err.Error())
+	}
+
+	if err := ValidateHarvestMetrics(DefaultMetrics); err == nil || !strings.Contains(err.Error(), "availability_state") {
+		t.Errorf("expected the availability filter of the default metrics to be rejected, got %v", err)
+	}
+}
+
+func TestHarvestLogin(t *testing.T) {
+	h, _ := testHarvest(t)
+	if err := h.Login(context.Background()); err != nil {
+		t.Errorf("unexpected error logging in with an api key: %s", err.Error())
+	}
+
+	h = NewHarvest(h.baseUrl, "", "")
+	if err := h.Login(context.Background()); err == nil {
+		t.Errorf("expected an error logging in without an api key")
+	}
+}
+
+func TestHarvestUnauthorized(t *testing.T) {
+	h, _ := testHarvest(t)
+	h.apiKey = "wrong"
+
+	_, err := h.RoleTitle(context.Background(), 100)
+	if err == nil {
+		t.Errorf("expected an error when using an invalid api key")
+	}
+}
+
+// testHarvest starts a stand-in Harvest API server which serves the canned
+// responses in testdata/harvest, and returns a client configured to use it,
+// along with a count of requests made to each path
+func testHarvest(t *testing.T) (*Harvest, map[string]int) {
+	t.Helper()
+
+	replacer := strings.NewReplacer(
+		"{{ now }}", time.Now().UTC().Format(time.RFC3339),
+		"{{ old }}", time.Now().UTC().AddDate(0, 0, -30).Format(time.RFC3339),
+	)
+
+	requests := map[string]int{}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+
+		if key, _, _ := r.BasicAuth(); key != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var file string
+		var id int64
+
+		switch {
+		case r.URL.Path == "/v1/jobs/100":
+			file = "job.json"
+		case r.URL.Path == "/v1/jobs/100/stages":
+			file = "stages.json"
+		case r.URL.Path == "/v1/applications" && r.URL.Query().Get("job_id") == "100":
+			file = "applications-1.json"
+			if r.URL.Query().Get("page") == "2" {
+				file = "applications-2.json"
+			} else {
+				w.Header().Set("Link", fmt.Sprintf(`<%s/v1/applications?job_id=100&page=2>; rel="next"`, srv.URL))
+			}
+		case scan(r.URL.Path, "/v1/applications/%d/scheduled_interviews", &id):
+			file = fmt.Sprintf("scheduled_interviews-%d.json", id)
+		case scan(r.URL.Path, "/v1/applications/%d/scorecards", &id):
+			file = fmt.Sprintf("scorecards-%d.json", id)
+		case r.URL.Path == "/v1/candidates":
+			people := []string{}
+			for _, id := range strings.Split(r.URL.Query().Get("candidate_ids"), ",") {
+				people = append(people, fmt.Sprintf(`{"id": %s, "first_name": "Candidate", "last_name": "%s"}`, id, id))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, "[%s]", strings.Join(people, ","))
+			return
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		b, err := os.ReadFile(filepath.Join("testdata", "harvest", file))
+		if err != nil {
+			// Applications without canned interviews or scorecards have none
+			b = []byte("[]")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(replacer.Replace(string(b))))
+	}))
+	t.Cleanup(srv.Close)
+
+	return NewHarvest(srv.URL+"/v1", "secret", ""), requests
+}
+
+// scan is a helper for matching a URL path against a pattern containing an ID
+func scan(path, format string, id *int64) bool {
+	n, err := fmt.Sscanf(path, format, id)
+	return err == nil && n == 1 && fmt.Sprintf(format, *id) == path
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package greenhouse
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile blocks until it takes an exclusive advisory lock on f
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+// unlockFile releases a lock taken with lockFile
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,234 @@
+package greenhouse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// FilterSet is a set of Greenhouse URL query parameters used to filter the
+// candidates page for a given role
+type FilterSet map[string]string
+
+// Query is the set of parameters used to filter the candidates page of a role
+// for a metric, both as configured and with any templated values evaluated
+type Query struct {
+	// Raw are the parameters as configured, which recorded pages are keyed on
+	// so that they can be replayed on later days
+	Raw FilterSet
+	// Values are the parameters with any templated values evaluated, which are
+	// used to filter the candidates
+	Values FilterSet
+}
+
+// Metric is a single statistic gathered for each role. Each metric has a
+// unique key, a label used as the column header in output, a description and
+// the set of Greenhouse query parameters used to acquire its value.
+//
+// Query values may use Go template syntax to compute dynamic values at runtime,
+// for example: "{{ daysAgo 7 }}" evaluates to the date seven days ago in the
+// format Greenhouse expects.
+//
+// Attempts optionally overrides the maximum number of attempts made to fetch
+// the metric's value, if it fails transiently. Thresholds optionally mark
+// values which need attention in reports.
+type Metric struct {
+	Key         string     `yaml:"key"`
+	Label       string     `yaml:"label"`
+	Description string     `yaml:"description"`
+	Query       FilterSet  `yaml:"query"`
+	Attempts    int        `yaml:"attempts" json:"-"`
+	Thresholds  Thresholds `yaml:"thresholds" json:"-"`
+}
+
+// Thresholds are the values at or above which a metric needs attention. A
+// threshold of zero is not set.
+type Thresholds struct {
+	Warning  int `yaml:"warning"`
+	Critical int `yaml:"critical"`
+}
+
+// Threshold levels reported for a value
+const (
+	LevelWarning  = "warning"
+	LevelCritical = "critical"
+)
+
+// Level returns the highest threshold level reached by a value, or an empty
+// string if it reaches neither threshold
+func (t Thresholds) Level(value int) string {
+	switch {
+	case t.Critical > 0 && value >= t.Critical:
+		return LevelCritical
+	case t.Warning > 0 && value >= t.Warning:
+		return LevelWarning
+	default:
+		return ""
+	}
+}
+
+// Validate ensures that the thresholds are not negative, and that the
+// critical threshold is not below the warning threshold
+func (t Thresholds) Validate() error {
+	if t.Warning < 0 || t.Critical < 0 {
+		return errors.New("thresholds must not be negative")
+	}
+	if t.Warning > 0 && t.Critical > 0 && t.Critical < t.Warning {
+		return fmt.Errorf("critical threshold %d is below warning threshold %d", t.Critical, t.Warning)
+	}
+	return nil
+}
+
+// DefaultMetrics are the metrics gathered when none are specified in the
+// configuration file
+var DefaultMetrics = []Metric{
+	{
+		Key:         "appReviews",
+		Label:       "CVs",
+		Description: "Outstanding application reviews",
+		Query: FilterSet{
+			"in_stages[]": "Application Review",
+		},
+	},
+	{
+		Key:         "needsDecision",
+		Label:       "Decisions",
+		Description: "Candidates awaiting a decision",
+		Query: FilterSet{
+			"needs_decision": "1",
+		},
+	},
+	{
+		Key:         "needsScheduling",
+		Label:       "Scheduling",
+		Description: "Interviews to be scheduled where the candidate has submitted their availability",
+		Query: FilterSet{
+			"interview_status_id[]": "1",
+			"availability_state":    "received",
+		},
+	},
+	{
+		Key:         "wiScreening",
+		Label:       "WI (Screen)",
+		Description: "Outstanding written interview screenings",
+		Query: FilterSet{
+			"take_home_test_status_id[]": "9",
+			"in_stages[]":                "Written Interview",
+			"stage_status_id[]":          "2",
+		},
+	},
+	{
+		Key:         "wiGrading",
+		Label:       "WI (Grade)",
+		Description: "Outstanding written interview gradings",
+		Query: FilterSet{
+			"take_home_test_status_id[]": "9",
+			"in_stages[]":                "Hold",
+			"stage_status_id[]":          "2",
+		},
+	},
+	{
+		Key:         "stale",
+		Label:       "Stale",
+		Description: "Candidates who have seen no activity for 7 days or longer",
+		Query: FilterSet{
+			"last_activity_end": "{{ daysAgo 7 }}",
+		},
+	},
+}
+
+// now returns the current time, against which templated dates are evaluated
+var now = time.Now
+
+// queryFuncs are the functions available to templated query values
+var queryFuncs = template.FuncMap{
+	"daysAgo": func(days int) string {
+		return now().AddDate(0, 0, -days).Format("2006/01/02")
+	},
+}
+
+// reservedMetricKeys are the fields output for every role in JSON, which no
+// metric key may share
+var reservedMetricKeys = []string{"id", "title", "lead", "errors", "retries"}
+
+// ValidateMetrics ensures that a set of metrics have unique, non-empty keys
+// which aren't reserved, valid attempt limits and thresholds, and that any
+// templated query values can be parsed
+func ValidateMetrics(metrics []Metric) error {
+	seen := map[string]bool{}
+
+	for _, m := range metrics {
+		if len(m.Key) == 0 {
+			return fmt.Errorf("metric '%s' has no key", m.Label)
+		}
+
+		// Keys are compared case-insensitively, as the config file is
+		if slices.ContainsFunc(reservedMetricKeys, func(k string) bool { return strings.EqualFold(k, m.Key) }) {
+			return fmt.Errorf("metric key '%s' is reserved, please choose another", m.Key)
+		}
+
+		if seen[m.Key] {
+			return fmt.Errorf("metric key '%s' is specified more than once", m.Key)
+		}
+		seen[m.Key] = true
+
+		if m.Attempts < 0 {
+			return fmt.Errorf("metric '%s' has a negative number of attempts", m.Key)
+		}
+
+		if err := m.Thresholds.Validate(); err != nil {
+			return fmt.Errorf("metric '%s' has invalid thresholds: %w", m.Key, err)
+		}
+
+		if _, err := m.Queries(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Queries returns the metric's query parameters, with any templated values
+// evaluated
+func (m Metric) Queries() (FilterSet, error) {
+	queries := FilterSet{}
+
+	for k, v := range m.Query {
+		tmpl, err := template.New(k).Funcs(queryFuncs).Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse query '%s' for metric '%s': %w", k, m.Key, err)
+		}
+
+		var b bytes.Buffer
+		err = tmpl.Execute(&b, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate query '%s' for metric '%s': %w", k, m.Key, err)
+		}
+
+		queries[k] = b.String()
+	}
+
+	return queries, nil
+}
+
+// Evaluate returns the metric's query, with any templated values evaluated
+func (m Metric) Evaluate() (Query, error) {
+	values, err := m.Queries()
+	if err != nil {
+		return Query{}, err
+	}
+	return Query{Raw: m.Query, Values: values}, nil
+}
+
+// ColumnLabel returns the label used to represent the metric in tabular
+// output, falling back to the metric's key if no label is set
+func (m Metric) ColumnLabel() string {
+	if len(m.Label) > 0 {
+		return m.Label
+	}
+	return m.Key
+}
@@ -0,0 +1,66 @@
+package greenhouse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetricQueriesTemplated(t *testing.T) {
+	m := Metric{
+		Key:   "stale",
+		Query: FilterSet{"last_activity_end": "{{ daysAgo 7 }}", "type": "all"},
+	}
+
+	queries, err := m.Queries()
+	if err != nil {
+		t.Fatalf("failed to evaluate metric queries: %s", err.Error())
+	}
+
+	expected := time.Now().AddDate(0, 0, -7).Format("2006/01/02")
+	if queries["last_activity_end"] != expected {
+		t.Errorf("templated query evaluated incorrectly, expected %s, got %s", expected, queries["last_activity_end"])
+	}
+
+	if queries["type"] != "all" {
+		t.Errorf("static query value was modified, got %s", queries["type"])
+	}
+}
+
+func TestValidateMetrics(t *testing.T) {
+	if err := ValidateMetrics(DefaultMetrics); err != nil {
+		t.Errorf("default metrics failed validation: %s", err.Error())
+	}
+
+	tests := map[string][]Metric{
+		"missing key":   {{Label: "Foo"}},
+		"duplicate key": {{Key: "foo"}, {Key: "foo"}},
+		"reserved key":  {{Key: "title"}},
+		"reserved case": {{Key: "Errors"}},
+		"bad template":  {{Key: "foo", Query: FilterSet{"bar": "{{ daysAgo"}}},
+		"bad threshold": {{Key: "foo", Thresholds: Thresholds{Warning: 10, Critical: 5}}},
+	}
+
+	for name, metrics := range tests {
+		if err := ValidateMetrics(metrics); err == nil {
+			t.Errorf("expected validation error for metrics with %s", name)
+		}
+	}
+}
+
+func TestThresholdsLevel(t *testing.T) {
+	th := Thresholds{Warning: 5, Critical: 10}
+
+	for value, expected := range map[int]string{0: "", 4: "", 5: LevelWarning, 9: LevelWarning, 10: LevelCritical, 50: LevelCritical} {
+		if level := th.Level(value); level != expected {
+			t.Errorf("incorrect level for %d, expected '%s', got '%s'", value, expected, level)
+		}
+	}
+
+	if level := (Thresholds{}).Level(100); level != "" {
+		t.Errorf("expected no level without thresholds, got '%s'", level)
+	}
+
+	if level := (Thresholds{Critical: 3}).Level(3); level != LevelCritical {
+		t.Errorf("expected a critical level without a warning threshold, got '%s'", level)
+	}
+}
@@ -0,0 +1,77 @@
+package greenhouse
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"time"
+
+	"jnsgruk/ghstat/internal/totp"
+)
+
+// TOTPSecret describes where to find the seed used to generate the one-time
+// passwords required to log in. If both are set, File takes precedence.
+type TOTPSecret struct {
+	// File is the path of a file containing the seed
+	File string
+	// Command is a shell command which prints the seed, such as a password
+	// manager's command line client
+	Command string
+}
+
+// otp generates a one-time password from the seed in the specified environment
+// variable, or the configured file or command, in that order. It returns an
+// empty string if no seed is available.
+func (s TOTPSecret) otp(ctx context.Context, env string, now time.Time) (string, error) {
+	seed, err := s.seed(ctx, env)
+	if err != nil || len(seed) == 0 {
+		return "", err
+	}
+
+	key, err := totp.DecodeSecret(seed)
+	if err != nil {
+		return "", err
+	}
+
+	return totp.Code(key, now, totp.DefaultOptions), nil
+}
+
+// seed reads the encoded seed from the first of its sources which is set
+func (s TOTPSecret) seed(ctx context.Context, env string) (string, error) {
+	if seed := os.Getenv(env); len(seed) > 0 {
+		return seed, nil
+	}
+
+	if len(s.File) > 0 {
+		info, err := os.Stat(s.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to read totp secret file: %w", err)
+		}
+
+		if info.Mode().Perm()&0077 != 0 {
+			slog.Warn("totp secret file is accessible by other users", "file", s.File, "mode", info.Mode().Perm().String())
+		}
+
+		buf, err := os.ReadFile(s.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to read totp secret file: %w", err)
+		}
+		return string(bytes.TrimSpace(buf)), nil
+	}
+
+	if len(s.Command) > 0 {
+		cmd := exec.CommandContext(ctx, "sh", "-c", s.Command)
+		cmd.Stderr = os.Stderr
+
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("failed to run totp secret command: %w", err)
+		}
+		return string(bytes.TrimSpace(out)), nil
+	}
+
+	return "", nil
+}
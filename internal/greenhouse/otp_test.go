@@ -0,0 +1,62 @@
+package greenhouse
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// "12345678901234567890" in base32, the key used by the RFC 6238 test vectors
+const testTOTPSeed = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPSecret(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "seed")
+	if err := os.WriteFile(file, []byte(testTOTPSeed+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write seed file: %s", err.Error())
+	}
+
+	t.Setenv("GHSTAT_TEST_TOTP", "")
+
+	for name, secret := range map[string]TOTPSecret{
+		"file":    {File: file},
+		"command": {Command: "echo " + testTOTPSeed},
+		"both":    {File: file, Command: "false"},
+	} {
+		otp, err := secret.otp(context.Background(), "GHSTAT_TEST_TOTP", time.Unix(59, 0))
+		if err != nil || otp != "287082" {
+			t.Errorf("incorrect otp generated from %s, expected 287082, got '%s' (%v)", name, otp, err)
+		}
+	}
+
+	// The environment variable takes precedence over the configured sources
+	t.Setenv("GHSTAT_TEST_TOTP", testTOTPSeed)
+	otp, err := TOTPSecret{Command: "false"}.otp(context.Background(), "GHSTAT_TEST_TOTP", time.Unix(59, 0))
+	if err != nil || otp != "287082" {
+		t.Errorf("incorrect otp generated from environment, expected 287082, got '%s' (%v)", otp, err)
+	}
+}
+
+func TestTOTPSecretNone(t *testing.T) {
+	t.Setenv("GHSTAT_TEST_TOTP", "")
+
+	otp, err := TOTPSecret{}.otp(context.Background(), "GHSTAT_TEST_TOTP", time.Now())
+	if err != nil || otp != "" {
+		t.Errorf("expected no otp without a seed, got '%s' (%v)", otp, err)
+	}
+}
+
+func TestTOTPSecretInvalid(t *testing.T) {
+	t.Setenv("GHSTAT_TEST_TOTP", "")
+
+	for name, secret := range map[string]TOTPSecret{
+		"missing file":   {File: filepath.Join(t.TempDir(), "missing")},
+		"failed command": {Command: "exit 1"},
+		"invalid seed":   {Command: "echo 'not base32!'"},
+	} {
+		if _, err := secret.otp(context.Background(), "GHSTAT_TEST_TOTP", time.Now()); err == nil {
+			t.Errorf("expected an error generating an otp from %s", name)
+		}
+	}
+}
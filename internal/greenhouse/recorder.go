@@ -0,0 +1,85 @@
+package greenhouse
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// recording describes a candidates page that was saved in record mode
+type recording struct {
+	RoleID  int64             `json:"roleId"`
+	Queries map[string]string `json:"queries"`
+	URL     string            `json:"url"`
+}
+
+// pageKey returns a stable name for the candidates page of a role fetched with
+// a given set of queries, which is independent of the order of the queries
+func pageKey(roleId int64, queries map[string]string) string {
+	fields := url.Values{}
+	for k, v := range queries {
+		fields.Add(k, v)
+	}
+
+	// Encode sorts the fields by key, so the hash is stable for a given set
+	sum := sha256.Sum256([]byte(fields.Encode()))
+	return fmt.Sprintf("%d-%s", roleId, hex.EncodeToString(sum[:])[:16])
+}
+
+// recordingQueries returns the queries a recording is keyed on, which are the
+// evaluated values of the query with each configured value in its unevaluated
+// form, so that pages are recorded against the query as configured rather
+// than against templated values such as dates, which change from day to day.
+// Values added while fetching, such as the page number, are kept as they are.
+func recordingQueries(query Query) map[string]string {
+	keyed := map[string]string{}
+	for k, v := range query.Values {
+		if r, ok := query.Raw[k]; ok {
+			v = r
+		}
+		keyed[k] = v
+	}
+	return keyed
+}
+
+// recordPage saves the rendered HTML of a candidates page into dir, alongside a
+// description of the role, queries and URL used to fetch it
+func recordPage(dir string, roleId int64, queries map[string]string, pageUrl, html string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	key := pageKey(roleId, queries)
+
+	err = os.WriteFile(filepath.Join(dir, key+".html"), []byte(html), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write recorded page: %w", err)
+	}
+
+	buf, err := json.MarshalIndent(recording{RoleID: roleId, Queries: queries, URL: pageUrl}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal recording data: %w", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, key+".json"), buf, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write recording data: %w", err)
+	}
+
+	return nil
+}
+
+// replayPage loads the rendered HTML of a candidates page previously saved to
+// dir by recordPage
+func replayPage(dir string, roleId int64, queries map[string]string) (string, error) {
+	buf, err := os.ReadFile(filepath.Join(dir, pageKey(roleId, queries)+".html"))
+	if err != nil {
+		return "", fmt.Errorf("no recorded page for role %d with queries %v: %w", roleId, queries, err)
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,93 @@
+package greenhouse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPageKeyStable(t *testing.T) {
+	a := pageKey(123, map[string]string{"in_stages[]": "Hold", "stage_status_id[]": "2"})
+	b := pageKey(123, map[string]string{"stage_status_id[]": "2", "in_stages[]": "Hold"})
+
+	if a != b {
+		t.Errorf("page key depends on query ordering: %s != %s", a, b)
+	}
+
+	if a == pageKey(456, map[string]string{"in_stages[]": "Hold", "stage_status_id[]": "2"}) {
+		t.Errorf("page key is the same for different roles")
+	}
+
+	if a == pageKey(123, map[string]string{"in_stages[]": "Hold"}) {
+		t.Errorf("page key is the same for different queries")
+	}
+}
+
+func TestRecordReplayPage(t *testing.T) {
+	dir := t.TempDir()
+	queries := map[string]string{"needs_decision": "1"}
+	html := `<html><body><span id="results_count">4</span></body></html>`
+
+	err := recordPage(dir, 123, queries, "https://canonical.greenhouse.io/plans/123/candidates", html)
+	if err != nil {
+		t.Fatalf("failed to record page: %s", err.Error())
+	}
+
+	replayed, err := replayPage(dir, 123, queries)
+	if err != nil {
+		t.Fatalf("failed to replay page: %s", err.Error())
+	}
+
+	if replayed != html {
+		t.Errorf("replayed page did not match recorded page")
+	}
+
+	_, err = replayPage(dir, 123, map[string]string{})
+	if err == nil {
+		t.Errorf("expected an error replaying a page that was not recorded")
+	}
+}
+
+func TestRecordReplayPageTemplatedQuery(t *testing.T) {
+	t.Cleanup(func() { now = time.Now })
+
+	dir := t.TempDir()
+	m := Metric{Key: "stale", Query: FilterSet{"last_activity_end": "{{ daysAgo 7 }}"}}
+	html := `<html><body><span id="results_count">4</span></body></html>`
+
+	now = func() time.Time { return time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC) }
+	recorded, err := m.Evaluate()
+	if err != nil {
+		t.Fatalf("failed to evaluate metric queries: %s", err.Error())
+	}
+
+	err = recordPage(dir, 123, recordingQueries(recorded), "https://canonical.greenhouse.io/plans/123/candidates", html)
+	if err != nil {
+		t.Fatalf("failed to record page: %s", err.Error())
+	}
+
+	// Replaying on a later day evaluates the query to a different date
+	now = func() time.Time { return time.Date(2024, 6, 9, 12, 0, 0, 0, time.UTC) }
+	replayed, err := m.Evaluate()
+	if err != nil {
+		t.Fatalf("failed to evaluate metric queries: %s", err.Error())
+	}
+
+	if replayed.Values["last_activity_end"] == recorded.Values["last_activity_end"] {
+		t.Fatalf("expected the query to evaluate to a different date when replayed")
+	}
+
+	page, err := replayPage(dir, 123, recordingQueries(replayed))
+	if err != nil {
+		t.Fatalf("failed to replay page recorded on an earlier day: %s", err.Error())
+	}
+
+	if page != html {
+		t.Errorf("replayed page did not match recorded page")
+	}
+
+	// Queries added while fetching still distinguish recordings
+	paged := recordingQueries(Query{Raw: m.Query, Values: FilterSet{"last_activity_end": "2024/05/25", "page": "2"}})
+	if _, err := replayPage(dir, 123, paged); err == nil {
+		t.Errorf("expected an error replaying a page that was not recorded")
+	}
+}
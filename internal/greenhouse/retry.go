@@ -0,0 +1,180 @@
+package greenhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+// ErrorKind classifies the failures encountered while fetching a value from
+// Greenhouse, so that transient failures can be retried
+type ErrorKind string
+
+// Kinds of failure encountered while fetching a value from Greenhouse
+const (
+	// ErrorKindNavigation is a failure to open or load a page
+	ErrorKindNavigation ErrorKind = "navigation"
+	// ErrorKindTimeout is a request or page which took too long to respond
+	ErrorKindTimeout ErrorKind = "timeout"
+	// ErrorKindMissingElement is an element which could not be found on a page.
+	// This is usually because the page layout has changed, so it is retried at
+	// most once, in case the page had not finished rendering.
+	ErrorKindMissingElement ErrorKind = "missing-element"
+	// ErrorKindUnparsable is a value on a page which could not be parsed
+	ErrorKindUnparsable ErrorKind = "unparsable"
+	// ErrorKindAuthRedirect is a redirect to the login page, because the session
+	// has expired
+	ErrorKindAuthRedirect ErrorKind = "auth-redirect"
+)
+
+// Transient reports whether a failure of this kind may succeed if retried
+func (k ErrorKind) Transient() bool {
+	switch k {
+	case ErrorKindNavigation, ErrorKindTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// FetchError is a failure to fetch a value from Greenhouse, of a known kind
+type FetchError struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Classify returns the kind of failure described by err, or an empty kind if
+// it is not known
+func Classify(err error) ErrorKind {
+	if err == nil {
+		return ""
+	}
+
+	if errors.Is(err, ErrSessionExpired) {
+		return ErrorKindAuthRedirect
+	}
+
+	var fe *FetchError
+	if errors.As(err, &fe) {
+		return fe.Kind
+	}
+
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()) {
+		return ErrorKindTimeout
+	}
+
+	return ""
+}
+
+// elementErrorKind classifies a failed lookup of an element on a page. Lookups
+// wait for the element to render, so a lookup which runs out of time is
+// reported as a timeout, and may succeed if retried on a slow page.
+func elementErrorKind(err error) ErrorKind {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorKindTimeout
+	}
+	return ErrorKindMissingElement
+}
+
+// RetryPolicy controls how fetches which fail transiently are retried. Each
+// retry waits for an exponentially increasing, jittered backoff.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts made for each fetch
+	Attempts int `yaml:"attempts"`
+	// InitialBackoff is the wait before the first retry, which doubles with
+	// each subsequent retry
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	// MaxBackoff is the longest wait between retries
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+}
+
+// DefaultRetryPolicy is used for any fields of a RetryPolicy which are unset
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, InitialBackoff: 500 * time.Millisecond, MaxBackoff: 10 * time.Second}
+
+// withDefaults returns the policy with any unset fields taken from
+// DefaultRetryPolicy
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.Attempts <= 0 {
+		p.Attempts = DefaultRetryPolicy.Attempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultRetryPolicy.MaxBackoff
+	}
+	return p
+}
+
+// Validate checks that the policy's backoffs are consistent
+func (p RetryPolicy) Validate() error {
+	if p.Attempts < 0 || p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return errors.New("retry attempts and backoffs must not be negative")
+	}
+
+	p = p.withDefaults()
+	if p.InitialBackoff > p.MaxBackoff {
+		return fmt.Errorf("initial backoff %s is longer than the maximum backoff %s", p.InitialBackoff, p.MaxBackoff)
+	}
+
+	return nil
+}
+
+// Do calls fetch until it succeeds, fails with an error that isn't transient,
+// or the attempts are exhausted, returning the number of retries made and the
+// error from the last attempt. A missing element is retried only once. Each
+// retry is logged at debug level along with the specified attributes.
+func (p RetryPolicy) Do(ctx context.Context, fetch func() error, attrs ...any) (int, error) {
+	p = p.withDefaults()
+	missing := 0
+
+	for attempt := 1; ; attempt++ {
+		err := fetch()
+		if err == nil || attempt >= p.Attempts || ctx.Err() != nil {
+			return attempt - 1, err
+		}
+
+		kind := Classify(err)
+		if kind == ErrorKindMissingElement {
+			missing++
+		}
+		if !kind.Transient() && (kind != ErrorKindMissingElement || missing > 1) {
+			return attempt - 1, err
+		}
+
+		backoff := p.backoff(attempt)
+		slog.Debug("retrying failed fetch", append(attrs, "kind", kind, "attempt", attempt, "backoff", backoff, "error", err.Error())...)
+
+		select {
+		case <-ctx.Done():
+			return attempt - 1, err
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// backoff returns the wait before retrying after the specified attempt, which
+// is chosen at random between half and all of the exponential backoff, so
+// that concurrent retries are spread out
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxBackoff)
+
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,162 @@
+package greenhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testRetryPolicy retries quickly, so that tests don't wait for the backoff
+var testRetryPolicy = RetryPolicy{Attempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+func TestClassify(t *testing.T) {
+	for err, expected := range map[error]ErrorKind{
+		nil:                      "",
+		errors.New("unknown"):    "",
+		context.DeadlineExceeded: ErrorKindTimeout,
+		fmt.Errorf("%w, redirected to the login page", ErrSessionExpired):                        ErrorKindAuthRedirect,
+		&FetchError{Kind: ErrorKindMissingElement, Err: errors.New("not found")}:                 ErrorKindMissingElement,
+		fmt.Errorf("failed: %w", &FetchError{Kind: ErrorKindUnparsable, Err: errors.New("nan")}): ErrorKindUnparsable,
+	} {
+		if kind := Classify(err); kind != expected {
+			t.Errorf("incorrect classification of '%v', expected '%s', got '%s'", err, expected, kind)
+		}
+	}
+}
+
+func TestElementErrorKind(t *testing.T) {
+	for err, expected := range map[error]ErrorKind{
+		errors.New("element not found"):                  ErrorKindMissingElement,
+		fmt.Errorf("wait: %w", context.DeadlineExceeded): ErrorKindTimeout,
+		fmt.Errorf("wait: %w", context.Canceled):         ErrorKindMissingElement,
+	} {
+		if kind := elementErrorKind(err); kind != expected {
+			t.Errorf("incorrect classification of element lookup error '%v', expected '%s', got '%s'", err, expected, kind)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	calls := 0
+	retries, err := testRetryPolicy.Do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return &FetchError{Kind: ErrorKindNavigation, Err: errors.New("connection reset")}
+		}
+		return nil
+	})
+
+	if err != nil || retries != 2 || calls != 3 {
+		t.Errorf("expected success after 2 retries, got %d retries, %d calls (%v)", retries, calls, err)
+	}
+}
+
+func TestRetryPolicyDoMissingElement(t *testing.T) {
+	calls := 0
+	policy := testRetryPolicy
+	policy.Attempts = 4
+
+	retries, err := policy.Do(context.Background(), func() error {
+		calls++
+		return &FetchError{Kind: ErrorKindMissingElement, Err: errors.New("not found")}
+	})
+
+	if Classify(err) != ErrorKindMissingElement || retries != 1 || calls != 2 {
+		t.Errorf("expected a missing element to be retried once, got %d retries, %d calls (%v)", retries, calls, err)
+	}
+}
+
+func TestRetryPolicyDoExhausted(t *testing.T) {
+	calls := 0
+	policy := testRetryPolicy
+	policy.Attempts = 4
+
+	retries, err := policy.Do(context.Background(), func() error {
+		calls++
+		return &FetchError{Kind: ErrorKindTimeout, Err: errors.New("too slow")}
+	})
+
+	if Classify(err) != ErrorKindTimeout || retries != 3 || calls != 4 {
+		t.Errorf("expected to give up after 4 attempts, got %d retries, %d calls (%v)", retries, calls, err)
+	}
+}
+
+func TestRetryPolicyDoNotTransient(t *testing.T) {
+	for _, fetchErr := range []error{
+		errors.New("unknown"),
+		&FetchError{Kind: ErrorKindUnparsable, Err: errors.New("nan")},
+		ErrSessionExpired,
+	} {
+		calls := 0
+		retries, err := testRetryPolicy.Do(context.Background(), func() error {
+			calls++
+			return fetchErr
+		})
+
+		if !errors.Is(err, fetchErr) || retries != 0 || calls != 1 {
+			t.Errorf("expected '%v' not to be retried, got %d retries, %d calls", fetchErr, retries, calls)
+		}
+	}
+}
+
+func TestRetryPolicyDoCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	_, err := testRetryPolicy.Do(ctx, func() error {
+		calls++
+		cancel()
+		return &FetchError{Kind: ErrorKindNavigation, Err: ctx.Err()}
+	})
+
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("expected no retries once cancelled, got %d calls (%v)", calls, err)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{Attempts: 10, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	for attempt, max := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	} {
+		for range 20 {
+			if d := p.backoff(attempt); d < max/2 || d > max {
+				t.Errorf("backoff for attempt %d should be between %s and %s, got %s", attempt, max/2, max, d)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	valid := []RetryPolicy{
+		{},
+		{Attempts: 1},
+		{Attempts: 5, InitialBackoff: time.Second, MaxBackoff: time.Minute},
+	}
+
+	for _, p := range valid {
+		if err := p.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %s", p, err.Error())
+		}
+	}
+
+	invalid := []RetryPolicy{
+		{Attempts: -1},
+		{InitialBackoff: time.Minute},
+		{InitialBackoff: time.Second, MaxBackoff: time.Millisecond},
+	}
+
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", p)
+		}
+	}
+}
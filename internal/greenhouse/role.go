@@ -1,147 +1,242 @@
 package greenhouse
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"log/slog"
-	"time"
 )
 
-// NumRoleFields is the number of fields that are fetched from greenhouse.
-// The +1 is for the title, on top of the numeric fields map
-var NumRoleFields = len(filters) + 1
+// NumRoleFields is the number of fields that are fetched from greenhouse for
+// a role with the given metrics. The +1 is for the title, on top of the metrics.
+func NumRoleFields(metrics []Metric) int {
+	return len(metrics) + 1
+}
 
 // Role represents a given req on Greenhouse
 type Role struct {
-	ID     int64  `json:"id"`
-	Title  string `json:"title"`
-	Lead   string `json:"lead"`
-	fields map[string]int
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Lead  string `json:"lead"`
+	// Retry controls how fields which fail transiently are retried
+	Retry        RetryPolicy `json:"-"`
+	metrics      []Metric
+	fields       map[string]MetricValue
+	titleErr     error
+	titleRetries int
 }
 
-// NewRole constructs a new Role with a given ID
-func NewRole(id int64, lead string) *Role {
-	return &Role{
-		ID:     id,
-		Lead:   lead,
-		fields: make(map[string]int),
-	}
+// MetricValue is the value of a metric for a role, or the error encountered
+// while trying to retrieve it, along with the number of retries made and the
+// evaluated queries it was counted with
+type MetricValue struct {
+	Count   int
+	Err     error
+	Retries int
+	Queries FilterSet
 }
 
-// Type alias for a set of Greenhouse queries
-type filterSet map[string]string
-
-// filters represents the various URL query parameters required to
-// filter the candidate page with to acquire the correct value
-var filters map[string]filterSet = map[string]filterSet{
-	"appReviews": {
-		"in_stages[]": "Application Review",
-	},
-	"needsDecision": {
-		"needs_decision": "1",
-	},
-	"needsScheduling": {
-		"interview_status_id[]": "1",
-		"availability_state":    "received",
-	},
-	"wiScreening": {
-		"take_home_test_status_id[]": "9",
-		"in_stages[]":                "Written Interview",
-		"stage_status_id[]":          "2",
-	},
-	"wiGrading": {
-		"take_home_test_status_id[]": "9",
-		"in_stages[]":                "Hold",
-		"stage_status_id[]":          "2",
-	},
-	"stale": {
-		"last_activity_end": time.Now().AddDate(0, 0, -7).Format("2006/01/02"),
-	},
+// Known reports whether the value was retrieved successfully
+func (v MetricValue) Known() bool {
+	return v.Err == nil
+}
+
+// FieldError describes a failure to retrieve one of a role's fields
+type FieldError struct {
+	Field string    `json:"field"`
+	Error string    `json:"error"`
+	Kind  ErrorKind `json:"kind,omitempty"`
+}
+
+// NewRole constructs a new Role with a given ID, which will gather the
+// specified metrics when populated
+func NewRole(id int64, lead string, metrics []Metric) *Role {
+	return &Role{
+		ID:      id,
+		Lead:    lead,
+		metrics: metrics,
+		fields:  make(map[string]MetricValue),
+	}
 }
 
 // Populate is used to fetch the details of each field from Greenhouse using
-// the specified filters
-func (r *Role) Populate(g GreenhouseClient, incProgress func(amount int64)) error {
+// the queries specified by the role's metrics. Fields which fail transiently
+// are retried according to the role's retry policy, and the metric's attempt
+// limit. Failures to retrieve individual fields are recorded against the field,
+// rather than failing the role, unless the session has expired. Population
+// stops early if the context is cancelled.
+func (r *Role) Populate(ctx context.Context, g GreenhouseClient, incProgress func(amount int64)) error {
 	slog.Debug("processing role", "roleId", r.ID, "lead", r.Lead)
 
-	title, err := g.RoleTitle(r.ID)
+	var title string
+	retries, err := r.Retry.Do(ctx, func() (err error) {
+		title, err = g.RoleTitle(ctx, r.ID)
+		return err
+	}, "role", r.ID, "field", "title")
 	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, ErrSessionExpired) {
+			return err
+		}
 		slog.Debug("failed to retrieve title for role", "role", r.ID, "error", err.Error())
 	}
 
 	r.Title = title
+	r.titleErr = err
+	r.titleRetries = retries
 	incProgress(1)
 
-	for k, v := range filters {
-		count, err := g.CandidateCount(r.ID, v)
+	for _, m := range r.metrics {
+		query, err := m.Evaluate()
+		if err != nil {
+			return err
+		}
+
+		policy := r.Retry
+		if m.Attempts > 0 {
+			policy.Attempts = m.Attempts
+		}
+
+		var count int
+		retries, err := policy.Do(ctx, func() (err error) {
+			count, err = g.CandidateCount(ctx, r.ID, query)
+			return err
+		}, "role", r.ID, "field", m.Key)
 		if err != nil {
-			slog.Debug("failed to retrieve field", "role", r.ID, "field", k, "error", err.Error())
-			count = 0
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if errors.Is(err, ErrSessionExpired) {
+				return err
+			}
+			slog.Debug("failed to retrieve field", "role", r.ID, "field", m.Key, "error", err.Error())
 		}
-		r.fields[k] = count
+		r.fields[m.Key] = MetricValue{Count: count, Err: err, Retries: retries, Queries: query.Values}
 		incProgress(1)
 	}
 
 	return nil
 }
 
-// AppReviews returns the number of outstanding application reviews
-// for the role
-func (r *Role) AppReviews() int {
-	return r.fields["appReviews"]
+// Metrics returns the list of metrics gathered for the role
+func (r *Role) Metrics() []Metric {
+	return r.metrics
 }
 
-// NeedsDecision returns the number of outstanding decisions to be
-// made about candidates on a role
-func (r *Role) NeedsDecision() int {
-	return r.fields["needsDecision"]
+// Value returns the value of the metric with the specified key, or zero if
+// the value could not be retrieved
+func (r *Role) Value(key string) int {
+	if v := r.fields[key]; v.Known() {
+		return v.Count
+	}
+	return 0
 }
 
-// NeedsScheduling returns the number of outstanding interviews
-// to be scheduled for the role where the candidate has
-// already submitted their availability
-func (r *Role) NeedsScheduling() int {
-	return r.fields["needsScheduling"]
+// Result returns the value of the metric with the specified key, along with
+// any error encountered while retrieving it
+func (r *Role) Result(key string) MetricValue {
+	return r.fields[key]
 }
 
-// WIScreening returns the number of outstanding written
-// interview screenings for the role
-func (r *Role) WIScreening() int {
-	return r.fields["wiScreening"]
+// TitleErr returns the error encountered while retrieving the role's title
+func (r *Role) TitleErr() error {
+	return r.titleErr
 }
 
-// WIGrading returns the number of outstanding written
-// interview gradings for the role
-func (r *Role) WIGrading() int {
-	return r.fields["wiGrading"]
+// Errors returns the failures encountered while retrieving the role's title
+// and metrics, in the order the fields are output
+func (r *Role) Errors() []FieldError {
+	errs := []FieldError{}
+
+	if r.titleErr != nil {
+		errs = append(errs, FieldError{Field: "title", Error: r.titleErr.Error(), Kind: Classify(r.titleErr)})
+	}
+
+	for _, m := range r.metrics {
+		if v := r.fields[m.Key]; !v.Known() {
+			errs = append(errs, FieldError{Field: m.Key, Error: v.Err.Error(), Kind: Classify(v.Err)})
+		}
+	}
+
+	return errs
 }
 
-// Stale returns the number of candidates who have seen no activity
-// for 7 days or longer
-func (r *Role) Stale() int {
-	return r.fields["stale"]
+// Retries returns the number of retries made to retrieve each of the role's
+// fields, omitting fields which were retrieved at the first attempt
+func (r *Role) Retries() map[string]int {
+	retries := map[string]int{}
+
+	if r.titleRetries > 0 {
+		retries["title"] = r.titleRetries
+	}
+
+	for _, m := range r.metrics {
+		if v := r.fields[m.Key]; v.Retries > 0 {
+			retries[m.Key] = v.Retries
+		}
+	}
+
+	return retries
 }
 
-// MarshalJSON implements a custom marshaller to get the output format we want
+// MarshalJSON implements a custom marshaller to get the output format we want,
+// with each metric represented as a top-level field in the order configured.
+// Fields which could not be retrieved are null, and described in 'errors'.
+// Fields which were retried have their number of retries listed in 'retries'.
 func (r *Role) MarshalJSON() ([]byte, error) {
-	return json.Marshal(&struct {
-		ID              int64  `json:"id"`
-		Title           string `json:"title"`
-		Lead            string `json:"lead"`
-		AppReviews      int    `json:"appReviews"`
-		NeedsDecision   int    `json:"needsDecision"`
-		NeedsScheduling int    `json:"needsScheduling"`
-		WIScreening     int    `json:"wiScreening"`
-		WIGrading       int    `json:"wiGrading"`
-		Stale           int    `json:"stale"`
-	}{
-		ID:              r.ID,
-		Title:           r.Title,
-		Lead:            r.Lead,
-		AppReviews:      r.AppReviews(),
-		NeedsDecision:   r.NeedsDecision(),
-		NeedsScheduling: r.NeedsScheduling(),
-		WIScreening:     r.WIScreening(),
-		WIGrading:       r.WIGrading(),
-		Stale:           r.Stale(),
-	})
+	type field struct {
+		key   string
+		value any
+	}
+
+	var title any = r.Title
+	if r.titleErr != nil {
+		title = nil
+	}
+
+	fields := []field{{"id", r.ID}, {"title", title}, {"lead", r.Lead}}
+	for _, m := range r.metrics {
+		var value any = r.Value(m.Key)
+		if !r.fields[m.Key].Known() {
+			value = nil
+		}
+		fields = append(fields, field{m.Key, value})
+	}
+
+	if errs := r.Errors(); len(errs) > 0 {
+		fields = append(fields, field{"errors", errs})
+	}
+
+	if retries := r.Retries(); len(retries) > 0 {
+		fields = append(fields, field{"retries", retries})
+	}
+
+	var b bytes.Buffer
+	b.WriteByte('{')
+
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		k, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+
+	b.WriteByte('}')
+	return b.Bytes(), nil
 }
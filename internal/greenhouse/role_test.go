@@ -1,13 +1,16 @@
 package greenhouse
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestRolePopulate(t *testing.T) {
-	r := NewRole(666, "Joe Bloggs")
+	r := NewRole(666, "Joe Bloggs", DefaultMetrics)
 
 	progress := 0
 	incProgress := func(a int64) {
@@ -16,14 +19,14 @@ func TestRolePopulate(t *testing.T) {
 
 	g := &FakeGreenhouse{}
 
-	err := r.Populate(g, incProgress)
+	err := r.Populate(context.Background(), g, incProgress)
 
 	if err != nil {
 		t.Errorf("error populating role: %s", err.Error())
 	}
 
-	if progress != NumRoleFields {
-		t.Errorf("incorrect progress reporting when populating role, expected %d, got %d", progress, NumRoleFields)
+	if progress != NumRoleFields(DefaultMetrics) {
+		t.Errorf("incorrect progress reporting when populating role, expected %d, got %d", NumRoleFields(DefaultMetrics), progress)
 	}
 
 	expectedFields := map[string]int{
@@ -35,17 +38,23 @@ func TestRolePopulate(t *testing.T) {
 		"wiScreening":     17,
 	}
 
-	if fmt.Sprint(r.fields) != fmt.Sprint(expectedFields) {
-		t.Errorf("incorrect fields returned from role population")
+	for k, v := range expectedFields {
+		if r.Result(k).Count != v || !r.Result(k).Known() {
+			t.Errorf("incorrect value for field '%s' returned from role population", k)
+		}
+	}
+
+	if len(r.Errors()) != 0 {
+		t.Errorf("unexpected errors from role population: %v", r.Errors())
 	}
 }
 
 func TestRoleJSONMarshal(t *testing.T) {
-	r := NewRole(666, "Steve Jobs")
+	r := NewRole(666, "Steve Jobs", DefaultMetrics)
 
 	incProgress := func(a int64) {}
 	g := &FakeGreenhouse{}
-	r.Populate(g, incProgress)
+	r.Populate(context.Background(), g, incProgress)
 
 	b, err := json.Marshal(r)
 	if err != nil {
@@ -59,16 +68,199 @@ func TestRoleJSONMarshal(t *testing.T) {
 	}
 }
 
+func TestRolePopulateCustomMetrics(t *testing.T) {
+	metrics := []Metric{
+		{Key: "offers", Label: "Offers", Query: FilterSet{"in_stages[]": "Offer"}},
+		{Key: "rejected", Label: "Rejected", Query: FilterSet{"status": "rejected"}},
+	}
+
+	r := NewRole(666, "Steve Jobs", metrics)
+	r.Populate(context.Background(), &FakeGreenhouse{}, func(a int64) {})
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Errorf("failed to marshal role as json: %s", err.Error())
+	}
+
+	expected := `{"id":666,"title":"Fake Role","lead":"Steve Jobs","offers":17,"rejected":17}`
+
+	if string(b) != expected {
+		t.Errorf("role with custom metrics marshalled incorrectly to JSON, got %s", string(b))
+	}
+}
+
+func TestRolePopulateRecordsQueries(t *testing.T) {
+	t.Cleanup(func() { now = time.Now })
+	now = func() time.Time { return time.Date(2024, 6, 1, 23, 59, 0, 0, time.UTC) }
+
+	metrics := []Metric{{Key: "stale", Query: FilterSet{"last_activity_end": "{{ daysAgo 7 }}"}}}
+	r := NewRole(666, "Joe Bloggs", metrics)
+
+	err := r.Populate(context.Background(), &FakeGreenhouse{}, func(a int64) {})
+	if err != nil {
+		t.Fatalf("error populating role: %s", err.Error())
+	}
+
+	// The queries are recorded as they were evaluated when the value was
+	// counted, rather than evaluated again when they are read
+	now = func() time.Time { return time.Date(2024, 6, 2, 0, 1, 0, 0, time.UTC) }
+
+	if q := r.Result("stale").Queries; q["last_activity_end"] != "2024/05/25" {
+		t.Errorf("expected the queries the value was counted with, got %v", q)
+	}
+}
+
+func TestRolePopulateCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := NewRole(666, "Joe Bloggs", DefaultMetrics)
+	err := r.Populate(ctx, &CancelledGreenhouse{}, func(a int64) {})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected role population to be cancelled, got: %v", err)
+	}
+}
+
+func TestRolePopulateFailures(t *testing.T) {
+	metrics := []Metric{
+		{Key: "offers", Query: FilterSet{"in_stages[]": "Offer"}},
+		{Key: "broken", Query: FilterSet{"broken": "1"}},
+	}
+
+	r := NewRole(666, "Steve Jobs", metrics)
+	err := r.Populate(context.Background(), &FailingGreenhouse{}, func(a int64) {})
+	if err != nil {
+		t.Fatalf("failures to retrieve fields should not fail the role: %s", err.Error())
+	}
+
+	if r.Result("broken").Known() || r.TitleErr() == nil {
+		t.Errorf("failed fields should be recorded as unknown")
+	}
+
+	if !r.Result("offers").Known() || r.Value("offers") != 17 {
+		t.Errorf("successful fields should be recorded as known")
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Errorf("failed to marshal role as json: %s", err.Error())
+	}
+
+	expected := `{"id":666,"title":null,"lead":"Steve Jobs","offers":17,"broken":null,"errors":[{"field":"title","error":"no title"},{"field":"broken","error":"no results count"}]}`
+
+	if string(b) != expected {
+		t.Errorf("role with failures marshalled incorrectly to JSON, got %s", string(b))
+	}
+}
+
+func TestRolePopulateRetries(t *testing.T) {
+	metrics := []Metric{
+		{Key: "offers", Query: FilterSet{"in_stages[]": "Offer"}},
+		{Key: "slow", Query: FilterSet{"slow": "1"}},
+		{Key: "slower", Query: FilterSet{"slow": "2"}, Attempts: 2},
+	}
+
+	r := NewRole(666, "Steve Jobs", metrics)
+	r.Retry = testRetryPolicy
+
+	err := r.Populate(context.Background(), &FlakyGreenhouse{}, func(a int64) {})
+	if err != nil {
+		t.Fatalf("error populating role: %s", err.Error())
+	}
+
+	if v := r.Result("slow"); !v.Known() || v.Count != 17 || v.Retries != 1 {
+		t.Errorf("expected slow field to succeed after one retry, got %+v", v)
+	}
+
+	// The metric's attempt limit overrides the policy
+	if v := r.Result("slower"); v.Known() || v.Retries != 1 {
+		t.Errorf("expected slower field to fail after one retry, got %+v", v)
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Errorf("failed to marshal role as json: %s", err.Error())
+	}
+
+	expected := `{"id":666,"title":"Fake Role","lead":"Steve Jobs","offers":17,"slow":17,"slower":null,"errors":[{"field":"slower","error":"results not rendered","kind":"missing-element"}],"retries":{"slow":1,"slower":1}}`
+
+	if string(b) != expected {
+		t.Errorf("role with retries marshalled incorrectly to JSON, got %s", string(b))
+	}
+}
+
 type FakeGreenhouse struct{}
 
-func (fg *FakeGreenhouse) RoleTitle(roleId int64) (string, error) {
+func (fg *FakeGreenhouse) RoleTitle(ctx context.Context, roleId int64) (string, error) {
 	return "Fake Role", nil
 }
 
-func (fg *FakeGreenhouse) CandidateCount(roleId int64, query map[string]string) (int, error) {
+func (fg *FakeGreenhouse) CandidateCount(ctx context.Context, roleId int64, query Query) (int, error) {
 	return 17, nil
 }
 
-func (fg *FakeGreenhouse) Login() error {
+func (fg *FakeGreenhouse) Candidates(ctx context.Context, roleId int64, query Query) ([]Candidate, error) {
+	return []Candidate{{ID: 1, Name: "Joe Bloggs"}}, nil
+}
+
+func (fg *FakeGreenhouse) Login(ctx context.Context) error {
+	return nil
+}
+
+func (fg *FakeGreenhouse) Close() error {
 	return nil
 }
+
+// CancelledGreenhouse fails every request with the error from its context
+type CancelledGreenhouse struct {
+	FakeGreenhouse
+}
+
+func (cg *CancelledGreenhouse) RoleTitle(ctx context.Context, roleId int64) (string, error) {
+	return "", ctx.Err()
+}
+
+func (cg *CancelledGreenhouse) CandidateCount(ctx context.Context, roleId int64, query Query) (int, error) {
+	return -1, ctx.Err()
+}
+
+// FailingGreenhouse fails to retrieve the title, and any count with a 'broken' query
+type FailingGreenhouse struct {
+	FakeGreenhouse
+}
+
+func (fg *FailingGreenhouse) RoleTitle(ctx context.Context, roleId int64) (string, error) {
+	return "", errors.New("no title")
+}
+
+func (fg *FailingGreenhouse) CandidateCount(ctx context.Context, roleId int64, query Query) (int, error) {
+	if _, ok := query.Values["broken"]; ok {
+		return -1, errors.New("no results count")
+	}
+	return 17, nil
+}
+
+// FlakyGreenhouse fails to render the count for 'slow' queries until it has
+// been requested as many times as the query's value
+type FlakyGreenhouse struct {
+	FakeGreenhouse
+	calls map[string]int
+}
+
+func (fg *FlakyGreenhouse) CandidateCount(ctx context.Context, roleId int64, query Query) (int, error) {
+	if fg.calls == nil {
+		fg.calls = map[string]int{}
+	}
+
+	slow, ok := query.Values["slow"]
+	if !ok {
+		return 17, nil
+	}
+
+	fg.calls[slow]++
+	if n, _ := strconv.Atoi(slow); fg.calls[slow] <= n {
+		return -1, &FetchError{Kind: ErrorKindMissingElement, Err: errors.New("results not rendered")}
+	}
+	return 17, nil
+}
@@ -0,0 +1,76 @@
+package greenhouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Session describes the Greenhouse session saved by a previous login
+type Session struct {
+	// Host is the Greenhouse host that the session belongs to
+	Host string `json:"host"`
+	// Account is the account that was logged in to, if known
+	Account string `json:"account,omitempty"`
+	// Saved is when the session was saved
+	Saved time.Time `json:"saved"`
+	// Expires is the earliest expiry of the session's cookies for the host,
+	// which is zero if they only last for the browser session
+	Expires time.Time `json:"expires"`
+	// Valid reports whether Greenhouse accepts the session
+	Valid bool `json:"valid"`
+}
+
+// Status reports the session saved by a previous login, and whether Greenhouse
+// still accepts it. ErrNoSession is returned if no session has been saved.
+func (g *Greenhouse) Status(ctx context.Context) (*Session, error) {
+	sess, err := g.cookies.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w, please run 'ghstat auth login'", ErrNoSession)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Session{Host: sess.Host, Account: sess.Account, Saved: sess.Saved}
+
+	// Sessions saved by previous versions of ghstat don't record their host
+	host := g.baseUrl.Hostname()
+	if len(status.Host) == 0 {
+		status.Host = g.baseUrl.Host
+	}
+
+	for _, c := range sess.Cookies {
+		domain := strings.TrimPrefix(c.Domain, ".")
+		if c.Session || (host != domain && !strings.HasSuffix(host, "."+domain)) {
+			continue
+		}
+
+		expires := c.Expires.Time()
+		if status.Expires.IsZero() || expires.Before(status.Expires) {
+			status.Expires = expires
+		}
+	}
+
+	page, loggedIn, err := g.openHome(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closePage(page)
+
+	status.Valid = loggedIn
+	return status, nil
+}
+
+// ClearSession removes the session saved by a previous login, so that the next
+// run of ghstat must log in again
+func ClearSession(opts Options) error {
+	g, err := newGreenhouse(opts)
+	if err != nil {
+		return err
+	}
+	return g.cookies.Clear()
+}
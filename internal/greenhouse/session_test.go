@@ -0,0 +1,60 @@
+package greenhouse
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"jnsgruk/ghstat/internal/credentials/credentialstest"
+)
+
+func TestSessionStatus(t *testing.T) {
+	t.Setenv("GREENHOUSE_LOGIN", "joe@example.com")
+	t.Setenv("GREENHOUSE_PASSWORD", "hunter2")
+
+	srv := fakeLoginServer(t, "/users/sign_in", []map[string]string{
+		{"user_email": "joe@example.com", "user_password": "hunter2"},
+	})
+
+	g := testLoginGreenhouse(t, srv, LoginProviderGreenhouse, "/users/sign_in", &credentialstest.Prompter{})
+
+	if _, err := g.Status(context.Background()); !errors.Is(err, ErrNoSession) {
+		t.Errorf("expected ErrNoSession before logging in, got %v", err)
+	}
+
+	if err := g.Login(context.Background()); err != nil {
+		t.Fatalf("failed to log in: %s", err.Error())
+	}
+
+	status, err := g.Status(context.Background())
+	if err != nil {
+		t.Fatalf("failed to check session status: %s", err.Error())
+	}
+
+	if !status.Valid || status.Account != "joe@example.com" || status.Host != g.baseUrl.Host {
+		t.Errorf("incorrect session status after logging in: %+v", status)
+	}
+
+	if err := g.cookies.Clear(); err != nil {
+		t.Fatalf("failed to clear session: %s", err.Error())
+	}
+
+	if _, err := g.Status(context.Background()); !errors.Is(err, ErrNoSession) {
+		t.Errorf("expected ErrNoSession after clearing the session, got %v", err)
+	}
+}
+
+func TestSessionExpiredRedirect(t *testing.T) {
+	srv := fakeLoginServer(t, "/users/sign_in", []map[string]string{{"user_email": "joe@example.com"}})
+
+	// Without logging in, every candidates page redirects to the login page
+	g := testLoginGreenhouse(t, srv, LoginProviderGreenhouse, "/users/sign_in", &credentialstest.Prompter{})
+
+	if _, err := g.CandidateCount(context.Background(), 100, Query{}); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("expected ErrSessionExpired fetching a candidates page without a session, got %v", err)
+	}
+
+	if _, err := g.RoleTitle(context.Background(), 100); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("expected ErrSessionExpired fetching a role title without a session, got %v", err)
+	}
+}
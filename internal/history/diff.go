@@ -0,0 +1,127 @@
+package history
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"jnsgruk/ghstat/internal/greenhouse"
+)
+
+// Diff describes the changes in each role's metrics between a previous
+// snapshot and the current results
+type Diff struct {
+	Since time.Time  `json:"since"`
+	Roles []RoleDiff `json:"roles"`
+}
+
+// RoleDiff describes the changes in a single role's metrics
+type RoleDiff struct {
+	ID     int64   `json:"id"`
+	Title  string  `json:"title"`
+	Lead   string  `json:"lead"`
+	New    bool    `json:"new"`
+	Deltas []Delta `json:"metrics"`
+}
+
+// Delta describes the change in the value of a single metric. Previous or
+// Current are nil where the value is not known.
+type Delta struct {
+	Key      string `json:"key"`
+	Previous *int   `json:"previous"`
+	Current  *int   `json:"current"`
+	Change   int    `json:"change"`
+}
+
+// Delta returns the change in the metric with the specified key
+func (rd RoleDiff) Delta(key string) (Delta, bool) {
+	for _, d := range rd.Deltas {
+		if d.Key == key {
+			return d, true
+		}
+	}
+	return Delta{}, false
+}
+
+// Compare computes the changes in the metrics of the specified roles since
+// the base snapshot was taken. Metrics or roles which are absent from the
+// base snapshot have no previous value, and metrics which could not be
+// retrieved have no current value.
+func Compare(base *Snapshot, roles []*greenhouse.Role) *Diff {
+	d := &Diff{Since: base.Timestamp, Roles: []RoleDiff{}}
+
+	for _, r := range roles {
+		prev, found := base.Role(r.ID, r.Lead)
+
+		rd := RoleDiff{
+			ID:     r.ID,
+			Title:  r.Title,
+			Lead:   r.Lead,
+			New:    !found,
+			Deltas: []Delta{},
+		}
+
+		for _, m := range r.Metrics() {
+			delta := Delta{Key: m.Key}
+
+			if v := r.Result(m.Key); v.Known() {
+				delta.Current = &v.Count
+			}
+
+			if v, ok := prev.Values[m.Key]; found && ok {
+				delta.Previous = &v
+			}
+
+			if delta.Previous != nil && delta.Current != nil {
+				delta.Change = *delta.Current - *delta.Previous
+			}
+
+			rd.Deltas = append(rd.Deltas, delta)
+		}
+
+		d.Roles = append(d.Roles, rd)
+	}
+
+	return d
+}
+
+// ParseSince parses a description of a point in history relative to now. It
+// accepts 'last' (the most recent snapshot), a duration such as '7d', '2w' or
+// '36h', an RFC 3339 timestamp or a date in the format '2006-01-02'.
+func ParseSince(since string, now time.Time) (time.Time, error) {
+	if len(since) == 0 || since == "last" {
+		return now, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, since); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", since, now.Location()); err == nil {
+		// Include snapshots taken at any point during the specified day
+		return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+	}
+
+	for suffix, days := range map[string]int{"d": 1, "w": 7} {
+		if n, ok := strings.CutSuffix(since, suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil {
+				break
+			}
+			if count <= 0 {
+				return time.Time{}, fmt.Errorf("invalid duration '%s', expected a positive duration", since)
+			}
+			return now.AddDate(0, 0, -count*days), nil
+		}
+	}
+
+	if d, err := time.ParseDuration(since); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("invalid duration '%s', expected a positive duration", since)
+		}
+		return now.Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time '%s', expected 'last', a duration such as '7d', or a timestamp", since)
+}
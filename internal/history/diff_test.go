@@ -0,0 +1,78 @@
+package history
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"jnsgruk/ghstat/internal/greenhouse"
+)
+
+func TestCompare(t *testing.T) {
+	metrics := []greenhouse.Metric{{Key: "stale"}, {Key: "offers"}}
+
+	r1 := greenhouse.NewRole(123, "Joe Bloggs", metrics)
+	r1.Populate(context.Background(), &FakeGreenhouse{}, func(a int64) {})
+	r2 := greenhouse.NewRole(456, "Joe Bloggs", metrics)
+	r2.Populate(context.Background(), &FakeGreenhouse{}, func(a int64) {})
+
+	// The base snapshot contains only the first role, and only one of its metrics
+	base := testSnapshot(time.Now().AddDate(0, 0, -1), 20)
+
+	diff := Compare(base, []*greenhouse.Role{r1, r2})
+
+	if !diff.Since.Equal(base.Timestamp) || len(diff.Roles) != 2 {
+		t.Fatalf("diff constructed incorrectly: %+v", diff)
+	}
+
+	if diff.Roles[0].New || !diff.Roles[1].New {
+		t.Errorf("roles incorrectly marked as new")
+	}
+
+	stale, _ := diff.Roles[0].Delta("stale")
+	if stale.Previous == nil || *stale.Previous != 20 || *stale.Current != 17 || stale.Change != -3 {
+		t.Errorf("incorrect delta for existing metric: %+v", stale)
+	}
+
+	offers, _ := diff.Roles[0].Delta("offers")
+	if offers.Previous != nil || offers.Change != 0 {
+		t.Errorf("metric absent from base snapshot should have no previous value: %+v", offers)
+	}
+
+	stale, _ = diff.Roles[1].Delta("stale")
+	if stale.Previous != nil {
+		t.Errorf("role absent from base snapshot should have no previous value: %+v", stale)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Time{
+		"":                     now,
+		"last":                 now,
+		"7d":                   now.AddDate(0, 0, -7),
+		"2w":                   now.AddDate(0, 0, -14),
+		"36h":                  now.Add(-36 * time.Hour),
+		"2024-06-01T09:00:00Z": time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC),
+		"2024-06-01":           time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC).Add(-time.Nanosecond),
+	}
+
+	for input, expected := range tests {
+		got, err := ParseSince(input, now)
+		if err != nil {
+			t.Errorf("failed to parse '%s': %s", input, err.Error())
+			continue
+		}
+
+		if !got.Equal(expected) {
+			t.Errorf("incorrect time parsed from '%s', expected %s, got %s", input, expected, got)
+		}
+	}
+
+	for _, input := range []string{"yesterday", "xd", "7y", "-3d", "0w", "-36h", "0s"} {
+		if _, err := ParseSince(input, now); err == nil {
+			t.Errorf("expected an error parsing '%s'", input)
+		}
+	}
+}
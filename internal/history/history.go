@@ -0,0 +1,230 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"jnsgruk/ghstat/internal/greenhouse"
+)
+
+// ErrNoSnapshot is returned when no snapshot matches a query against the store
+var ErrNoSnapshot = errors.New("no matching snapshot found in history")
+
+// timestampFormat is used to name snapshot files such that they sort chronologically
+const timestampFormat = "20060102T150405.000000000Z"
+
+// Snapshot is a record of the results of a single ghstat run
+type Snapshot struct {
+	Timestamp  time.Time      `json:"timestamp"`
+	ConfigHash string         `json:"configHash"`
+	Roles      []RoleSnapshot `json:"roles"`
+}
+
+// RoleSnapshot is a record of the metric values gathered for a role in a
+// single ghstat run
+type RoleSnapshot struct {
+	ID     int64          `json:"id"`
+	Title  string         `json:"title"`
+	Lead   string         `json:"lead"`
+	Values map[string]int `json:"values"`
+}
+
+// NewSnapshot constructs a snapshot of the current values of a set of roles
+func NewSnapshot(roles []*greenhouse.Role, configHash string) *Snapshot {
+	s := &Snapshot{
+		Timestamp:  time.Now().UTC(),
+		ConfigHash: configHash,
+		Roles:      []RoleSnapshot{},
+	}
+
+	for _, r := range roles {
+		// Values which could not be retrieved are omitted from the snapshot
+		values := map[string]int{}
+		for _, m := range r.Metrics() {
+			if v := r.Result(m.Key); v.Known() {
+				values[m.Key] = v.Count
+			}
+		}
+
+		s.Roles = append(s.Roles, RoleSnapshot{
+			ID:     r.ID,
+			Title:  r.Title,
+			Lead:   r.Lead,
+			Values: values,
+		})
+	}
+
+	return s
+}
+
+// Role returns the snapshot of the role with the given ID and lead, if present
+func (s *Snapshot) Role(id int64, lead string) (RoleSnapshot, bool) {
+	for _, r := range s.Roles {
+		if r.ID == id && r.Lead == lead {
+			return r, true
+		}
+	}
+	return RoleSnapshot{}, false
+}
+
+// RetentionPolicy controls which snapshots are removed when a store is pruned
+type RetentionPolicy struct {
+	// KeepDays is the number of days for which snapshots are kept. Zero keeps
+	// snapshots forever.
+	KeepDays int
+	// Daily keeps only the latest snapshot of each day for days before today
+	Daily bool
+}
+
+// Store is a directory of snapshots, one JSON file per run
+type Store struct {
+	dir string
+}
+
+// DefaultDir returns the default location of the history store within the
+// user's state directory
+func DefaultDir() string {
+	state := os.Getenv("XDG_STATE_HOME")
+	if len(state) == 0 {
+		home, _ := os.UserHomeDir()
+		state = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(state, "ghstat", "history")
+}
+
+// NewStore constructs a Store backed by the specified directory
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Save writes a snapshot to the store
+func (s *Store) Save(snap *Snapshot) error {
+	err := os.MkdirAll(s.dir, 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	buf, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal snapshot: %w", err)
+	}
+
+	err = os.WriteFile(s.path(snap), buf, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// List returns all of the snapshots in the store, oldest first
+func (s *Store) List() ([]*Snapshot, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []*Snapshot{}, nil
+		}
+		return nil, fmt.Errorf("failed to read history directory: %w", err)
+	}
+
+	snapshots := []*Snapshot{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+
+		buf, err := os.ReadFile(filepath.Join(s.dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+
+		snap := &Snapshot{}
+		err = json.Unmarshal(buf, snap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse snapshot '%s': %w", e.Name(), err)
+		}
+
+		snapshots = append(snapshots, snap)
+	}
+
+	slices.SortFunc(snapshots, func(a, b *Snapshot) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+
+	return snapshots, nil
+}
+
+// Latest returns the most recent snapshot in the store
+func (s *Store) Latest() (*Snapshot, error) {
+	return s.At(time.Now())
+}
+
+// At returns the most recent snapshot taken at or before the specified time
+func (s *Store) At(t time.Time) (*Snapshot, error) {
+	snapshots, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if !snapshots[i].Timestamp.After(t) {
+			return snapshots[i], nil
+		}
+	}
+
+	return nil, ErrNoSnapshot
+}
+
+// Prune removes snapshots from the store according to the retention policy,
+// returning the number of snapshots removed
+func (s *Store) Prune(policy RetentionPolicy, now time.Time) (int, error) {
+	snapshots, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	cutoff := today.AddDate(0, 0, -policy.KeepDays)
+
+	removed := 0
+	for i, snap := range snapshots {
+		expired := policy.KeepDays > 0 && snap.Timestamp.Before(cutoff)
+
+		// Snapshots are sorted, so a snapshot is superseded if the next snapshot
+		// was taken on the same day, before today
+		superseded := false
+		if policy.Daily && i+1 < len(snapshots) && snap.Timestamp.Before(today) {
+			superseded = sameDay(snap.Timestamp, snapshots[i+1].Timestamp, now.Location())
+		}
+
+		if !expired && !superseded {
+			continue
+		}
+
+		err := os.Remove(s.path(snap))
+		if err != nil {
+			return removed, fmt.Errorf("failed to remove snapshot: %w", err)
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// path returns the path of the file in which a snapshot is stored
+func (s *Store) path(snap *Snapshot) string {
+	return filepath.Join(s.dir, snap.Timestamp.UTC().Format(timestampFormat)+".json")
+}
+
+// sameDay reports whether two times fall on the same calendar day in a location
+func sameDay(a, b time.Time, loc *time.Location) bool {
+	ay, am, ad := a.In(loc).Date()
+	by, bm, bd := b.In(loc).Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,177 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"jnsgruk/ghstat/internal/greenhouse"
+)
+
+func TestNewSnapshot(t *testing.T) {
+	r := greenhouse.NewRole(123, "Joe Bloggs", greenhouse.DefaultMetrics)
+	r.Populate(context.Background(), &FakeGreenhouse{}, func(a int64) {})
+
+	snap := NewSnapshot([]*greenhouse.Role{r}, "abc")
+
+	if snap.ConfigHash != "abc" || len(snap.Roles) != 1 {
+		t.Fatalf("snapshot constructed incorrectly: %+v", snap)
+	}
+
+	role, ok := snap.Role(123, "Joe Bloggs")
+	if !ok {
+		t.Fatalf("role missing from snapshot")
+	}
+
+	if role.Title != "Fake Role" || len(role.Values) != len(greenhouse.DefaultMetrics) || role.Values["stale"] != 17 {
+		t.Errorf("role snapshot constructed incorrectly: %+v", role)
+	}
+}
+
+func TestStoreSaveList(t *testing.T) {
+	s := NewStore(t.TempDir())
+
+	now := time.Now().UTC()
+	for _, ts := range []time.Time{now, now.Add(-2 * time.Hour), now.Add(-time.Hour)} {
+		err := s.Save(testSnapshot(ts, 1))
+		if err != nil {
+			t.Fatalf("failed to save snapshot: %s", err.Error())
+		}
+	}
+
+	snapshots, err := s.List()
+	if err != nil {
+		t.Fatalf("failed to list snapshots: %s", err.Error())
+	}
+
+	if len(snapshots) != 3 {
+		t.Fatalf("expected 3 snapshots, got %d", len(snapshots))
+	}
+
+	for i := 1; i < len(snapshots); i++ {
+		if !snapshots[i-1].Timestamp.Before(snapshots[i].Timestamp) {
+			t.Errorf("snapshots not listed in chronological order")
+		}
+	}
+
+	latest, err := s.Latest()
+	if err != nil {
+		t.Fatalf("failed to fetch latest snapshot: %s", err.Error())
+	}
+
+	if !latest.Timestamp.Equal(now) {
+		t.Errorf("incorrect latest snapshot, expected %s, got %s", now, latest.Timestamp)
+	}
+}
+
+func TestStoreEmpty(t *testing.T) {
+	s := NewStore(t.TempDir() + "/missing")
+
+	snapshots, err := s.List()
+	if err != nil || len(snapshots) != 0 {
+		t.Errorf("expected no snapshots from an empty store")
+	}
+
+	_, err = s.Latest()
+	if !errors.Is(err, ErrNoSnapshot) {
+		t.Errorf("expected ErrNoSnapshot from an empty store, got %v", err)
+	}
+}
+
+func TestStoreAt(t *testing.T) {
+	s := NewStore(t.TempDir())
+
+	now := time.Now().UTC()
+	s.Save(testSnapshot(now.AddDate(0, 0, -10), 1))
+	s.Save(testSnapshot(now.AddDate(0, 0, -5), 2))
+	s.Save(testSnapshot(now, 3))
+
+	snap, err := s.At(now.AddDate(0, 0, -7))
+	if err != nil {
+		t.Fatalf("failed to fetch snapshot: %s", err.Error())
+	}
+
+	if snap.Roles[0].Values["stale"] != 1 {
+		t.Errorf("incorrect snapshot returned for time")
+	}
+
+	_, err = s.At(now.AddDate(0, 0, -11))
+	if !errors.Is(err, ErrNoSnapshot) {
+		t.Errorf("expected ErrNoSnapshot before the first snapshot, got %v", err)
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	s := NewStore(t.TempDir())
+
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+	timestamps := []time.Time{
+		// Expired
+		now.AddDate(0, 0, -100),
+		// Two snapshots on the same day, only the latter should be kept
+		now.AddDate(0, 0, -3).Add(-time.Hour),
+		now.AddDate(0, 0, -3),
+		// Two snapshots today, both should be kept
+		now.Add(-time.Hour),
+		now,
+	}
+
+	for i, ts := range timestamps {
+		s.Save(testSnapshot(ts, i))
+	}
+
+	removed, err := s.Prune(RetentionPolicy{KeepDays: 90, Daily: true}, now)
+	if err != nil {
+		t.Fatalf("failed to prune store: %s", err.Error())
+	}
+
+	if removed != 2 {
+		t.Errorf("expected 2 snapshots to be pruned, got %d", removed)
+	}
+
+	snapshots, _ := s.List()
+	kept := []int{}
+	for _, snap := range snapshots {
+		kept = append(kept, snap.Roles[0].Values["stale"])
+	}
+
+	if len(kept) != 3 || kept[0] != 2 || kept[1] != 3 || kept[2] != 4 {
+		t.Errorf("incorrect snapshots kept after pruning: %v", kept)
+	}
+}
+
+func testSnapshot(ts time.Time, value int) *Snapshot {
+	return &Snapshot{
+		Timestamp:  ts,
+		ConfigHash: "abc",
+		Roles: []RoleSnapshot{{
+			ID:     123,
+			Title:  "Fake Role",
+			Lead:   "Joe Bloggs",
+			Values: map[string]int{"stale": value},
+		}},
+	}
+}
+
+type FakeGreenhouse struct{}
+
+func (fg *FakeGreenhouse) RoleTitle(ctx context.Context, roleId int64) (string, error) {
+	return "Fake Role", nil
+}
+
+func (fg *FakeGreenhouse) CandidateCount(ctx context.Context, roleId int64, query greenhouse.Query) (int, error) {
+	return 17, nil
+}
+
+func (fg *FakeGreenhouse) Candidates(ctx context.Context, roleId int64, query greenhouse.Query) ([]greenhouse.Candidate, error) {
+	return []greenhouse.Candidate{}, nil
+}
+
+func (fg *FakeGreenhouse) Login(ctx context.Context) error {
+	return nil
+}
+
+func (fg *FakeGreenhouse) Close() error {
+	return nil
+}
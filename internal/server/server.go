@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"jnsgruk/ghstat/internal/formatters"
+	"jnsgruk/ghstat/internal/greenhouse"
+)
+
+// RefreshFunc gathers up to date statistics for each of the configured roles
+type RefreshFunc func(ctx context.Context) ([]*greenhouse.Role, error)
+
+// Server serves the statistics gathered for each role over HTTP, as JSON and
+// as an HTML dashboard. Statistics are refreshed periodically in the
+// background, and requests are served from the results of the last successful
+// refresh.
+type Server struct {
+	refresh  RefreshFunc
+	interval time.Duration
+	metrics  []greenhouse.Metric
+	leads    []string
+
+	mu          sync.RWMutex
+	roles       []*greenhouse.Role
+	lastRefresh time.Time
+	lastAttempt time.Time
+	lastErr     error
+	// duration is how long the last successful refresh took
+	duration time.Duration
+}
+
+// New constructs a Server which gathers statistics with refresh every
+// interval, for roles with the specified metrics belonging to the named leads
+func New(refresh RefreshFunc, interval time.Duration, metrics []greenhouse.Metric, leads []string) *Server {
+	return &Server{
+		refresh:  refresh,
+		interval: interval,
+		metrics:  metrics,
+		leads:    leads,
+		roles:    []*greenhouse.Role{},
+	}
+}
+
+// Run refreshes the statistics immediately, and then every interval until the
+// context is cancelled. A failed refresh is logged, and the statistics from
+// the last successful refresh continue to be served.
+func (s *Server) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Refresh(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh gathers up to date statistics, replacing the cached statistics if
+// successful
+func (s *Server) Refresh(ctx context.Context) {
+	slog.Info("refreshing role statistics")
+
+	start := time.Now()
+	roles, err := s.refresh(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastAttempt = start
+	s.lastErr = err
+
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("failed to refresh role statistics", "error", err.Error())
+		}
+		return
+	}
+
+	s.roles = roles
+	s.lastRefresh = start
+	s.duration = time.Since(start)
+	slog.Info("refreshed role statistics", "roles", len(roles), "duration", s.duration.Round(time.Millisecond))
+}
+
+// Handler returns the handler which serves the API, dashboard, metrics and
+// health endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleDashboard)
+	mux.HandleFunc("GET /api/roles", s.handleRoles)
+	mux.HandleFunc("GET /api/leads/{name}", s.handleLead)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.HandleFunc("GET /readyz", s.handleReady)
+	return mux
+}
+
+// snapshot returns the cached roles and the time they were refreshed
+func (s *Server) snapshot() ([]*greenhouse.Role, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.roles, s.lastRefresh
+}
+
+// handleRoles serves the statistics for every role, in the same format as the
+// JSON output of ghstat
+func (s *Server) handleRoles(w http.ResponseWriter, r *http.Request) {
+	roles, refreshed := s.snapshot()
+	s.writeRoles(w, roles, refreshed)
+}
+
+// handleLead serves the statistics for the roles of a single lead
+func (s *Server) handleLead(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !slices.Contains(s.leads, name) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown lead '" + name + "'"})
+		return
+	}
+
+	all, refreshed := s.snapshot()
+
+	roles := []*greenhouse.Role{}
+	for _, role := range all {
+		if role.Lead == name {
+			roles = append(roles, role)
+		}
+	}
+
+	s.writeRoles(w, roles, refreshed)
+}
+
+// writeRoles writes roles with the JSON formatter
+func (s *Server) writeRoles(w http.ResponseWriter, roles []*greenhouse.Role, refreshed time.Time) {
+	w.Header().Set("Content-Type", "application/json")
+	if !refreshed.IsZero() {
+		w.Header().Set("Last-Modified", refreshed.UTC().Format(http.TimeFormat))
+	}
+	formatters.NewFormatter("json", s.metrics, w).Output(roles)
+}
+
+// handleMetrics serves the statistics for every role in the OpenMetrics
+// format, along with how long the last refresh took, and the number of values
+// it could not retrieve
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	roles, duration := s.roles, s.duration
+	s.mu.RUnlock()
+
+	f := formatters.NewFormatter("openmetrics", s.metrics, w)
+	f.(formatters.ScrapeFormatter).SetScrape(formatters.NewScrape(roles, duration))
+
+	w.Header().Set("Content-Type", formatters.OpenMetricsContentType)
+	f.Output(roles)
+}
+
+// status describes the state of the server's statistics
+type status struct {
+	Status      string     `json:"status"`
+	LastRefresh *time.Time `json:"lastRefresh"`
+	LastAttempt *time.Time `json:"lastAttempt"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// status reports when the statistics were last refreshed, and whether the last
+// attempt to refresh them failed
+func (s *Server) status() status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := status{}
+	if refreshed := s.lastRefresh; !refreshed.IsZero() {
+		st.LastRefresh = &refreshed
+	}
+	if attempted := s.lastAttempt; !attempted.IsZero() {
+		st.LastAttempt = &attempted
+	}
+	if s.lastErr != nil {
+		st.Error = s.lastErr.Error()
+	}
+	return st
+}
+
+// handleHealth reports that the server is running, along with when the
+// statistics were last refreshed
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	st := s.status()
+	st.Status = "ok"
+	writeJSON(w, http.StatusOK, st)
+}
+
+// handleReady reports whether statistics have been gathered successfully, and
+// can be served
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	st := s.status()
+	if st.LastRefresh == nil {
+		st.Status = "not ready"
+		writeJSON(w, http.StatusServiceUnavailable, st)
+		return
+	}
+
+	st.Status = "ready"
+	writeJSON(w, http.StatusOK, st)
+}
+
+//go:embed dashboard.html
+var dashboardTemplate string
+
+// dashboard is the template for the HTML dashboard
+var dashboard = template.Must(template.New("dashboard").Funcs(formatters.RoleFuncs()).Parse(dashboardTemplate))
+
+// dashboardLead is a lead and their roles, as shown on the dashboard
+type dashboardLead struct {
+	Name  string
+	Roles []*greenhouse.Role
+}
+
+// handleDashboard renders a table of the statistics for each lead's roles
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	roles, refreshed := s.snapshot()
+	st := s.status()
+
+	leads := []dashboardLead{}
+	for _, name := range s.leads {
+		lead := dashboardLead{Name: name}
+		for _, role := range roles {
+			if role.Lead == name {
+				lead.Roles = append(lead.Roles, role)
+			}
+		}
+		leads = append(leads, lead)
+	}
+
+	data := map[string]any{
+		"Leads":       leads,
+		"Metrics":     s.metrics,
+		"Columns":     len(s.metrics) + 1,
+		"Refreshed":   refreshed,
+		"Error":       st.Error,
+		"RefreshSecs": int(min(s.interval, time.Minute).Seconds()),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := dashboard.Execute(w, data)
+	if err != nil {
+		slog.Error("failed to render dashboard", "error", err.Error())
+	}
+}
+
+// writeJSON writes v as the JSON body of a response with the specified status
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(v)
+	if err != nil {
+		slog.Error("could not marshal response", "error", err.Error())
+	}
+}
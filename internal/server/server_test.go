@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"jnsgruk/ghstat/internal/greenhouse"
+)
+
+var testMetrics = []greenhouse.Metric{
+	{Key: "offers", Label: "Offers", Query: greenhouse.FilterSet{"in_stages[]": "Offer"}},
+}
+
+func TestServerNotReady(t *testing.T) {
+	srv := testServer(t, nil)
+
+	resp, _ := get(t, srv, "/readyz")
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected server to be unready before refreshing, got %s", resp.Status)
+	}
+
+	resp, _ = get(t, srv, "/healthz")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected server to be healthy before refreshing, got %s", resp.Status)
+	}
+
+	resp, body := get(t, srv, "/api/roles")
+	if resp.StatusCode != http.StatusOK || body != "[]" {
+		t.Errorf("expected no roles before refreshing, got %s: %s", resp.Status, body)
+	}
+}
+
+func TestServerRoles(t *testing.T) {
+	srv := testServer(t, nil)
+	srv.Refresh(context.Background())
+
+	resp, body := get(t, srv, "/readyz")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected server to be ready after refreshing, got %s", resp.Status)
+	}
+
+	st := status{}
+	if err := json.Unmarshal([]byte(body), &st); err != nil || st.LastRefresh == nil {
+		t.Errorf("expected readiness to report the last refresh, got %s", body)
+	}
+
+	resp, body = get(t, srv, "/api/roles")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("failed to fetch roles: %s", resp.Status)
+	}
+
+	roles := []map[string]any{}
+	if err := json.Unmarshal([]byte(body), &roles); err != nil {
+		t.Fatalf("failed to parse roles: %s", err.Error())
+	}
+
+	if len(roles) != 3 || roles[0]["title"] != "Role 1" || roles[0]["offers"] != float64(17) {
+		t.Errorf("unexpected roles served: %s", body)
+	}
+
+	if resp.Header.Get("Last-Modified") == "" {
+		t.Errorf("expected roles to be served with the time they were refreshed")
+	}
+}
+
+func TestServerLead(t *testing.T) {
+	srv := testServer(t, nil)
+	srv.Refresh(context.Background())
+
+	resp, body := get(t, srv, "/api/leads/A.N.%20Other")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("failed to fetch roles for lead: %s", resp.Status)
+	}
+
+	roles := []map[string]any{}
+	if err := json.Unmarshal([]byte(body), &roles); err != nil {
+		t.Fatalf("failed to parse roles: %s", err.Error())
+	}
+
+	if len(roles) != 1 || roles[0]["lead"] != "A.N. Other" {
+		t.Errorf("expected only the lead's roles, got %s", body)
+	}
+
+	resp, _ = get(t, srv, "/api/leads/Nobody")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an unknown lead not to be found, got %s", resp.Status)
+	}
+}
+
+func TestServerRefreshFailure(t *testing.T) {
+	fail := false
+	srv := testServer(t, &fail)
+	srv.Refresh(context.Background())
+
+	fail = true
+	srv.Refresh(context.Background())
+
+	// The roles from the last successful refresh are still served
+	_, body := get(t, srv, "/api/roles")
+	roles := []map[string]any{}
+	if err := json.Unmarshal([]byte(body), &roles); err != nil || len(roles) != 3 {
+		t.Errorf("expected cached roles to be served after a failed refresh, got %s", body)
+	}
+
+	resp, body := get(t, srv, "/healthz")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "refresh failed") {
+		t.Errorf("expected health to report the failed refresh, got %s", body)
+	}
+
+	_, body = get(t, srv, "/")
+	if !strings.Contains(body, "The last refresh failed") {
+		t.Errorf("expected the dashboard to report the failed refresh")
+	}
+}
+
+func TestServerDashboard(t *testing.T) {
+	srv := testServer(t, nil)
+	srv.Refresh(context.Background())
+
+	resp, body := get(t, srv, "/")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("failed to fetch dashboard: %s", resp.Status)
+	}
+
+	for _, s := range []string{"<h2>Joe Bloggs</h2>", "<h2>A.N. Other</h2>", "Role 1", ">Offers<", ">17<", "Last refreshed"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("expected dashboard to contain '%s'", s)
+		}
+	}
+
+	resp, _ = get(t, srv, "/missing")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected unknown paths not to be found, got %s", resp.Status)
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	srv := testServer(t, nil)
+	srv.Refresh(context.Background())
+
+	resp, body := get(t, srv, "/metrics")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/openmetrics-text") {
+		t.Fatalf("failed to fetch metrics: %s", resp.Status)
+	}
+
+	for _, s := range []string{
+		"# TYPE ghstat_offers gauge\n",
+		`ghstat_offers{lead="A.N. Other",role_id="3",role_title="Role 3"} 17`,
+		"ghstat_scrape_duration_seconds ",
+		"ghstat_scrape_errors 0\n",
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("expected metrics to contain '%s', got:\n%s", s, body)
+		}
+	}
+
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("expected metrics to end with an EOF marker")
+	}
+}
+
+func TestServerRun(t *testing.T) {
+	refreshes := 0
+	srv := New(func(ctx context.Context) ([]*greenhouse.Role, error) {
+		refreshes++
+		return []*greenhouse.Role{}, nil
+	}, 10*time.Millisecond, testMetrics, []string{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 55*time.Millisecond)
+	defer cancel()
+	srv.Run(ctx)
+
+	if refreshes < 2 {
+		t.Errorf("expected statistics to be refreshed on an interval, refreshed %d times", refreshes)
+	}
+}
+
+// testServer constructs a server for two leads, which fails to refresh if
+// fail is set
+func testServer(t *testing.T, fail *bool) *Server {
+	t.Helper()
+
+	leads := map[int64]string{1: "Joe Bloggs", 2: "Joe Bloggs", 3: "A.N. Other"}
+
+	return New(func(ctx context.Context) ([]*greenhouse.Role, error) {
+		if fail != nil && *fail {
+			return nil, errors.New("refresh failed")
+		}
+
+		roles := []*greenhouse.Role{}
+		for _, id := range []int64{1, 2, 3} {
+			r := greenhouse.NewRole(id, leads[id], testMetrics)
+			if err := r.Populate(ctx, FakeGreenhouse{}, func(int64) {}); err != nil {
+				return nil, err
+			}
+			roles = append(roles, r)
+		}
+		return roles, nil
+	}, time.Minute, testMetrics, []string{"Joe Bloggs", "A.N. Other"})
+}
+
+// get requests a path from the server, returning the response and its body
+func get(t *testing.T, srv *Server, path string) (*http.Response, string) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	resp := rec.Result()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+// FakeGreenhouse titles each role after its ID, with 17 candidates for every query
+type FakeGreenhouse struct{}
+
+func (FakeGreenhouse) RoleTitle(ctx context.Context, roleId int64) (string, error) {
+	return "Role " + strconv.FormatInt(roleId, 10), nil
+}
+
+func (FakeGreenhouse) CandidateCount(ctx context.Context, roleId int64, query greenhouse.Query) (int, error) {
+	return 17, nil
+}
+
+func (FakeGreenhouse) Candidates(ctx context.Context, roleId int64, query greenhouse.Query) ([]greenhouse.Candidate, error) {
+	return []greenhouse.Candidate{}, nil
+}
+
+func (FakeGreenhouse) Login(ctx context.Context) error {
+	return nil
+}
+
+func (FakeGreenhouse) Close() error {
+	return nil
+}
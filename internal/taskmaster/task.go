@@ -1,8 +1,10 @@
 package taskmaster
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"sync"
 
 	"github.com/slok/gospinner"
 )
@@ -13,11 +15,18 @@ import (
 type Task struct {
 	Name    string
 	Verbose bool
+	// Plain reports progress with log lines rather than the spinner
+	Plain bool
 
-	message  string
 	taskFunc func(tc *TaskCtl) error
 	silent   bool
+
+	// mu guards the task's state, which may be read while the task runs, and
+	// updated concurrently by the task's function
+	mu       sync.Mutex
 	status   Status
+	err      error
+	message  string
 	progress float64
 
 	Spinner *gospinner.Spinner
@@ -62,14 +71,21 @@ func NewTask(name, message string, taskFunc func(tc *TaskCtl) error, silent bool
 	}
 }
 
-// Execute runs the task, performing any common preamble/cleanup
-func (t *Task) Execute() error {
+// Execute runs the task, performing any common preamble/cleanup. If the context
+// is cancelled while the task is running, the task is marked as failed with the
+// cause of the cancellation.
+func (t *Task) Execute(ctx context.Context) error {
 	t.start()
 
 	// Create a TaskCtl so the taskFunc can report progress, cancel, etc.
-	tc := &TaskCtl{task: t}
+	tc := &TaskCtl{task: t, ctx: ctx}
+
+	err := t.taskFunc(tc)
+	if ctx.Err() != nil {
+		err = fmt.Errorf("task cancelled: %w", context.Cause(ctx))
+	}
 
-	if err := t.taskFunc(tc); err != nil {
+	if err != nil {
 		t.fail(err)
 		return err
 	}
@@ -80,11 +96,23 @@ func (t *Task) Execute() error {
 
 // Status reports the status of the task
 func (t *Task) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	return t.status
 }
 
+// Err reports the reason for the task's failure, if any
+func (t *Task) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
 // SetProgress updates the internal progress value, and changes the message on the spinner
 func (t *Task) SetProgress(progress float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	t.progress = progress
 	if t.Spinner != nil {
 		t.Spinner.SetMessage(fmt.Sprintf("%s (%.0f%%)", t.message, t.progress))
@@ -93,7 +121,13 @@ func (t *Task) SetProgress(progress float64) {
 
 // SetMessage updates the spinner message for the task
 func (t *Task) SetMessage(message string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	t.message = message
+	if t.Plain && !t.silent {
+		slog.Info(message, "step", t.Name)
+	}
 	if t.Spinner != nil {
 		if t.progress != 0 {
 			t.Spinner.SetMessage(fmt.Sprintf("%s (%.0f%%)", t.message, t.progress))
@@ -105,9 +139,14 @@ func (t *Task) SetMessage(message string) {
 
 // start is called at the start of task execution and takes care of logging/output
 func (t *Task) start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	t.status = Started
 	if t.Verbose {
 		slog.Debug("started step", "step", t.Name)
+	} else if t.Plain && !t.silent {
+		slog.Info("started step", "step", t.Name, "message", t.message)
 	} else if !t.Verbose && !t.silent && t.Spinner != nil {
 		t.Spinner.Start(t.message)
 	}
@@ -115,9 +154,15 @@ func (t *Task) start() {
 
 // fail is called when the task fails, and used to output appropriately
 func (t *Task) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	t.status = Failed
+	t.err = err
 	if t.Verbose {
 		slog.Debug("failed step", "step", t.Name, "error", err.Error())
+	} else if t.Plain && !t.silent {
+		slog.Warn("failed step", "step", t.Name, "error", err.Error())
 	} else if !t.Verbose && !t.silent && t.Spinner != nil {
 		t.Spinner.SetMessage(t.message)
 		t.Spinner.Fail()
@@ -126,9 +171,14 @@ func (t *Task) fail(err error) {
 
 // succeed is called when the task succeeds, and used to output appropriately
 func (t *Task) succeed() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	t.status = Succeeded
 	if t.Verbose {
 		slog.Debug("completed step", "step", t.Name)
+	} else if t.Plain && !t.silent {
+		slog.Info("completed step", "step", t.Name)
 	} else if !t.Verbose && !t.silent && t.Spinner != nil {
 		t.Spinner.SetMessage(t.message)
 		t.Spinner.Succeed()
@@ -140,6 +190,13 @@ func (t *Task) succeed() {
 // but without exposing too much.
 type TaskCtl struct {
 	task *Task
+	ctx  context.Context
+}
+
+// Context returns the context for the task's execution, which is cancelled
+// when the task should stop
+func (tc *TaskCtl) Context() context.Context {
+	return tc.ctx
 }
 
 // SetProgress enables the task's function to report progress back to the Task
@@ -1,6 +1,7 @@
 package taskmaster
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -24,7 +25,7 @@ func TestTaskNewTask(t *testing.T) {
 func TestTaskExecuteSuccess(t *testing.T) {
 	task := NewTask("foo", "foobar", successWorker(), false)
 
-	err := task.Execute()
+	err := task.Execute(context.Background())
 	if err != nil {
 		t.Errorf("task should have succeeded, but got error: %s", err.Error())
 	}
@@ -43,7 +44,7 @@ func TestTaskExecuteWithProgress(t *testing.T) {
 
 	// Execute the task in a goroutine
 	go func() {
-		err := task.Execute()
+		err := task.Execute(context.Background())
 		if err != nil {
 			t.Errorf("task should have succeeded, but got error: %s", err.Error())
 		}
@@ -55,12 +56,16 @@ func TestTaskExecuteWithProgress(t *testing.T) {
 		t.Errorf("task status should have been set to 'Started', but got: %d", task.Status())
 	}
 
-	if task.progress != 50 {
-		t.Errorf("task progress should be 50, but got: %f", task.progress)
+	task.mu.Lock()
+	progress, message := task.progress, task.message
+	task.mu.Unlock()
+
+	if progress != 50 {
+		t.Errorf("task progress should be 50, but got: %f", progress)
 	}
 
-	if task.message != "Half Way" {
-		t.Errorf("task message should be 'Half Way', but got: %s", task.message)
+	if message != "Half Way" {
+		t.Errorf("task message should be 'Half Way', but got: %s", message)
 	}
 	<-c
 }
@@ -69,7 +74,7 @@ func TestTaskExecuteWithProgress(t *testing.T) {
 func TestTaskExecuteFail(t *testing.T) {
 	task := NewTask("foo", "foobar", failWorker("foo"), false)
 
-	err := task.Execute()
+	err := task.Execute(context.Background())
 	if err == nil {
 		t.Errorf("task should have failed")
 	}
@@ -101,6 +106,16 @@ func successWorker(d ...time.Duration) func(tc *TaskCtl) error {
 	}
 }
 
+// cancellingWorker is a task func that cancels its context, then waits for
+// the cancellation to be observed
+func cancellingWorker(cancel context.CancelFunc) func(tc *TaskCtl) error {
+	return func(tc *TaskCtl) error {
+		cancel()
+		<-tc.Context().Done()
+		return tc.Context().Err()
+	}
+}
+
 // failWorker is a simple task func that always fails
 func failWorker(n string) func(tc *TaskCtl) error {
 	return func(tc *TaskCtl) error {
@@ -1,6 +1,8 @@
 package taskmaster
 
 import (
+	"context"
+	"fmt"
 	"os"
 
 	"github.com/slok/gospinner"
@@ -11,6 +13,7 @@ import (
 type Taskmaster struct {
 	tasks   []*Task
 	verbose bool
+	plain   bool
 	spinner *gospinner.Spinner
 }
 
@@ -21,14 +24,16 @@ type TaskReport struct {
 	Status   Status
 	Message  string
 	Progress float64
+	Error    error
 }
 
 // NewTaskmaster constructs a new Manager with the specified config and
-// formatter
-func NewTaskmaster(verbose bool) (*Taskmaster, error) {
+// formatter. When not interactive, progress is reported with plain log lines
+// rather than a spinner.
+func NewTaskmaster(verbose, interactive bool) (*Taskmaster, error) {
 	var spinner *gospinner.Spinner
 
-	if !verbose {
+	if !verbose && interactive {
 		spinner, _ = gospinner.NewSpinnerWithColor(gospinner.Dots, gospinner.FgGreen)
 		spinner.Writer = os.Stderr
 	}
@@ -36,6 +41,7 @@ func NewTaskmaster(verbose bool) (*Taskmaster, error) {
 	return &Taskmaster{
 		spinner: spinner,
 		verbose: verbose,
+		plain:   !verbose && !interactive,
 	}, nil
 }
 
@@ -44,12 +50,15 @@ func (m *Taskmaster) Tasks() []TaskReport {
 	statuses := []TaskReport{}
 
 	for _, v := range m.tasks {
+		v.mu.Lock()
 		statuses = append(statuses, TaskReport{
 			Name:     v.Name,
 			Message:  v.message,
 			Progress: v.progress,
 			Status:   v.status,
+			Error:    v.err,
 		})
+		v.mu.Unlock()
 	}
 
 	return statuses
@@ -59,14 +68,20 @@ func (m *Taskmaster) Tasks() []TaskReport {
 func (m *Taskmaster) AddTask(task *Task) {
 	task.Spinner = m.spinner
 	task.Verbose = m.verbose
+	task.Plain = m.plain
 	m.tasks = append(m.tasks, task)
 }
 
-// Execute runs through the tasks in the Taskmaster, executing them sequentially
-func (m *Taskmaster) Execute() error {
+// Execute runs through the tasks in the Taskmaster, executing them sequentially.
+// No further tasks are started once the context is cancelled.
+func (m *Taskmaster) Execute(ctx context.Context) error {
 	for _, task := range m.tasks {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("tasks cancelled: %w", context.Cause(ctx))
+		}
+
 		if task.Status() == Ready {
-			err := task.Execute()
+			err := task.Execute(ctx)
 			if err != nil {
 				return err
 			}
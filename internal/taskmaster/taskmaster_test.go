@@ -1,6 +1,8 @@
 package taskmaster
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"slices"
@@ -9,7 +11,7 @@ import (
 
 // TestNewTaskmaster ensures that Taskmasters are created with the correct properties
 func TestNewTaskmaster(t *testing.T) {
-	tm, err := NewTaskmaster(false)
+	tm, err := NewTaskmaster(false, true)
 	if err != nil {
 		t.Error("failed to construct a new taskmaster")
 	}
@@ -27,7 +29,7 @@ func TestNewTaskmaster(t *testing.T) {
 // TestVerboseTaskmaster tests that no spinner is created when the
 // taskmaster is asked to be verbose
 func TestNewVerboseTaskmaster(t *testing.T) {
-	tm, err := NewTaskmaster(true)
+	tm, err := NewTaskmaster(true, true)
 	if err != nil {
 		t.Error("failed to construct a new taskmaster")
 	}
@@ -37,10 +39,35 @@ func TestNewVerboseTaskmaster(t *testing.T) {
 	}
 }
 
+// TestNewNonInteractiveTaskmaster tests that no spinner is created when the
+// taskmaster is not interactive, and that tasks report progress in log lines
+func TestNewNonInteractiveTaskmaster(t *testing.T) {
+	tm, err := NewTaskmaster(false, false)
+	if err != nil {
+		t.Error("failed to construct a new taskmaster")
+	}
+
+	if tm.spinner != nil {
+		t.Error("non-interactive taskmaster's spinner should be nil")
+	}
+
+	task := NewTask("foo", "foobar", successWorker(), false)
+	tm.AddTask(task)
+
+	if !task.Plain {
+		t.Error("task did not have it's plain property set when added to taskmaster")
+	}
+
+	err = tm.Execute(context.Background())
+	if err != nil {
+		t.Error("taskmaster execution returned an error")
+	}
+}
+
 // TestAddTask tests that when tasks are added to the taskmaster,
 // their spinner and verbose status is propagated correctly
 func TestAddTask(t *testing.T) {
-	tm, err := NewTaskmaster(false)
+	tm, err := NewTaskmaster(false, true)
 	if err != nil {
 		t.Error("failed to construct a new taskmaster")
 	}
@@ -64,7 +91,7 @@ func TestAddTask(t *testing.T) {
 // TestExecuteTasksSuccess tests a clean run where two tasks are added
 // and executed successfully
 func TestExecuteTasksSuccess(t *testing.T) {
-	tm, err := NewTaskmaster(false)
+	tm, err := NewTaskmaster(false, true)
 	if err != nil {
 		t.Error("failed to construct a new taskmaster")
 	}
@@ -72,7 +99,7 @@ func TestExecuteTasksSuccess(t *testing.T) {
 	tm.AddTask(NewTask("foo", "foobar", successWorker(), true))
 	tm.AddTask(NewTask("bar", "barbaz", successWorker(), true))
 
-	err = tm.Execute()
+	err = tm.Execute(context.Background())
 	if err != nil {
 		t.Error("taskmaster execution returned an error")
 	}
@@ -86,7 +113,7 @@ func TestExecuteTasksSuccess(t *testing.T) {
 
 // TestExecuteTasksFailure tries to execute two tasks, where the first fails
 func TestExecuteTasksFailure(t *testing.T) {
-	tm, err := NewTaskmaster(false)
+	tm, err := NewTaskmaster(false, true)
 	if err != nil {
 		t.Error("failed to construct a new taskmaster")
 	}
@@ -94,7 +121,7 @@ func TestExecuteTasksFailure(t *testing.T) {
 	tm.AddTask(NewTask("foo", "foobar", failWorker("foo"), true))
 	tm.AddTask(NewTask("bar", "barbaz", successWorker(), true))
 
-	err = tm.Execute()
+	err = tm.Execute(context.Background())
 	if err == nil {
 		t.Error("taskmaster execution should have failed")
 	}
@@ -108,7 +135,7 @@ func TestExecuteTasksFailure(t *testing.T) {
 // After the failure, the Taskmaster is executed again to run the next task
 // to completion
 func TestExecuteTasksFailureRetry(t *testing.T) {
-	tm, err := NewTaskmaster(false)
+	tm, err := NewTaskmaster(false, true)
 	if err != nil {
 		t.Error("failed to construct a new taskmaster")
 	}
@@ -116,12 +143,12 @@ func TestExecuteTasksFailureRetry(t *testing.T) {
 	tm.AddTask(NewTask("foo", "foobar", failWorker("foo"), true))
 	tm.AddTask(NewTask("bar", "barbaz", successWorker(), true))
 
-	err = tm.Execute()
+	err = tm.Execute(context.Background())
 	if err == nil {
 		t.Error("taskmaster execution should have failed")
 	}
 
-	err = tm.Execute()
+	err = tm.Execute(context.Background())
 	if err != nil {
 		t.Error("taskmaster execution failed")
 	}
@@ -132,7 +159,7 @@ func TestExecuteTasksFailureRetry(t *testing.T) {
 }
 
 func TestTaskmasterTasks(t *testing.T) {
-	tm, err := NewTaskmaster(false)
+	tm, err := NewTaskmaster(false, true)
 	if err != nil {
 		t.Error("failed to construct a new taskmaster")
 	}
@@ -159,13 +186,41 @@ func TestTaskmasterTasks(t *testing.T) {
 	}
 
 	// This should fail, but we already tested the error reporting above
-	_ = tm.Execute()
+	_ = tm.Execute(context.Background())
 
 	// Update the expected status - we expect the first task to be reporting as failed
 	expectedStatus[0].Status = Failed
+	expectedStatus[0].Error = fmt.Errorf("worker failed: foo")
 
 	if fmt.Sprint(expectedStatus) != fmt.Sprint(tm.Tasks()) {
 		t.Errorf("taskmaster reported inaccurate task report, expected %#v, got %#v", expectedStatus, tm.Tasks())
 	}
 
 }
+
+// TestExecuteTasksCancelled ensures that a running task is failed when the
+// context is cancelled, and that no further tasks are started
+func TestExecuteTasksCancelled(t *testing.T) {
+	tm, err := NewTaskmaster(false, true)
+	if err != nil {
+		t.Error("failed to construct a new taskmaster")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	tm.AddTask(NewTask("foo", "foobar", cancellingWorker(cancel), true))
+	tm.AddTask(NewTask("bar", "barbaz", successWorker(), true))
+
+	err = tm.Execute(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("taskmaster execution should have been cancelled, got: %v", err)
+	}
+
+	if tm.tasks[0].status != Failed || tm.tasks[1].status != Ready {
+		t.Error("tasks have inconsistent statuses")
+	}
+
+	if !errors.Is(tm.tasks[0].Err(), context.Canceled) {
+		t.Errorf("cancelled task should report the cancellation, got: %v", tm.tasks[0].Err())
+	}
+}
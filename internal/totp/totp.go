@@ -0,0 +1,92 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Options configures the generation of time-based one-time passwords
+type Options struct {
+	// Digits is the number of digits in each code
+	Digits int
+	// Period is the length of time for which each code is valid
+	Period time.Duration
+	// Hash is the hash function used for the HMAC
+	Hash func() hash.Hash
+}
+
+// DefaultOptions are the options used by most authenticator apps, and by the
+// Ubuntu One SSO: six digit codes, valid for 30 seconds, using HMAC-SHA1
+var DefaultOptions = Options{Digits: 6, Period: 30 * time.Second, Hash: sha1.New}
+
+// Code generates the time-based one-time password for key at time t, as
+// described in RFC 6238. Periods shorter than a second fall back to the
+// default period of 30 seconds.
+func Code(key []byte, t time.Time, opts Options) string {
+	period := opts.Period / time.Second
+	if period < 1 {
+		period = DefaultOptions.Period / time.Second
+	}
+
+	counter := uint64(t.Unix() / int64(period))
+	return HOTP(key, counter, opts.Digits, opts.Hash)
+}
+
+// HOTP generates the HMAC-based one-time password for key and counter, as
+// described in RFC 4226
+func HOTP(key []byte, counter uint64, digits int, h func() hash.Hash) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+
+	mac := hmac.New(h, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, taking four bytes from the offset given by the low
+	// four bits of the last byte
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range digits {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// DecodeSecret decodes a base32 encoded TOTP seed, as shown when setting up an
+// authenticator app. Spaces, padding and lowercase letters are tolerated, and
+// the seed may also be given as an 'otpauth://' URI.
+func DecodeSecret(secret string) ([]byte, error) {
+	secret = strings.TrimSpace(secret)
+
+	if strings.HasPrefix(secret, "otpauth://") {
+		u, err := url.Parse(secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse otpauth uri: %w", err)
+		}
+		secret = u.Query().Get("secret")
+	}
+
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	secret = strings.TrimRight(secret, "=")
+
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("empty totp secret")
+	}
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode totp secret: %w", err)
+	}
+
+	return key, nil
+}
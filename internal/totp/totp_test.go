@@ -0,0 +1,120 @@
+package totp
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"testing"
+	"time"
+)
+
+// Test vectors from RFC 4226, Appendix D
+func TestHOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+	expected := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	for counter, code := range expected {
+		if got := HOTP(key, uint64(counter), 6, sha1.New); got != code {
+			t.Errorf("incorrect hotp for counter %d, expected %s, got %s", counter, code, got)
+		}
+	}
+}
+
+// Test vectors from RFC 6238, Appendix B
+func TestCode(t *testing.T) {
+	keys := map[string][]byte{
+		"SHA1":   []byte("12345678901234567890"),
+		"SHA256": []byte("12345678901234567890123456789012"),
+		"SHA512": []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+
+	hashes := map[string]func() hash.Hash{
+		"SHA1":   sha1.New,
+		"SHA256": sha256.New,
+		"SHA512": sha512.New,
+	}
+
+	vectors := []struct {
+		time int64
+		mode string
+		code string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	for _, v := range vectors {
+		opts := Options{Digits: 8, Period: 30 * time.Second, Hash: hashes[v.mode]}
+
+		if got := Code(keys[v.mode], time.Unix(v.time, 0), opts); got != v.code {
+			t.Errorf("incorrect totp for %s at %d, expected %s, got %s", v.mode, v.time, v.code, got)
+		}
+	}
+}
+
+func TestDecodeSecret(t *testing.T) {
+	// "12345678901234567890" in base32
+	expected := "12345678901234567890"
+
+	for _, secret := range []string{
+		"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"gezd gnbv gy3t qojq gezd gnbv gy3t qojq",
+		"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ====",
+		"otpauth://totp/Ubuntu%20One:joe?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Ubuntu%20One",
+	} {
+		key, err := DecodeSecret(secret)
+		if err != nil {
+			t.Errorf("failed to decode secret '%s': %s", secret, err.Error())
+			continue
+		}
+
+		if string(key) != expected {
+			t.Errorf("incorrect key decoded from '%s', got '%s'", secret, string(key))
+		}
+	}
+
+	for _, secret := range []string{"", "not base32!", "otpauth://totp/joe"} {
+		if _, err := DecodeSecret(secret); err == nil {
+			t.Errorf("expected an error decoding invalid secret '%s'", secret)
+		}
+	}
+}
+
+func TestDefaultOptions(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	// The six digit code is the last six digits of the eight digit RFC vector
+	if got := Code(key, time.Unix(59, 0), DefaultOptions); got != "287082" {
+		t.Errorf("incorrect default totp at 59, expected 287082, got %s", got)
+	}
+}
+
+func TestCodeShortPeriod(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	for _, period := range []time.Duration{0, -time.Second, 500 * time.Millisecond} {
+		opts := DefaultOptions
+		opts.Period = period
+
+		if got := Code(key, time.Unix(59, 0), opts); got != "287082" {
+			t.Errorf("expected a period of %s to fall back to the default, got %s", period, got)
+		}
+	}
+}
@@ -1,14 +1,26 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
+	"jnsgruk/ghstat/internal/credentials"
+	"jnsgruk/ghstat/internal/debug"
 	"jnsgruk/ghstat/internal/ghstat"
 	"jnsgruk/ghstat/internal/greenhouse"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -36,12 +48,48 @@ leads:
 		# ID of the role in Greenhouse
 		- 1234567
 
+Optionally, a top-level 'metrics' list can be specified to override the built-in
+metrics gathered for each role:
+
+metrics:
+	- key: appReviews
+	  label: CVs
+	  description: Outstanding application reviews
+	  query:
+	    in_stages[]: Application Review
+
 By default, ghstat will try to reuse an active Greenhouse session by reading the cookies
-from a previous invocation. In the case that this isn't possible, it will prompt
-for Ubuntu One credentials. To streamline login, the following environment variables can be set:
+from a previous invocation. In the case that this isn't possible, it will read Ubuntu One
+credentials from the command set in 'greenhouse.login.credentials.command', which is passed
+the name of the credential (e.g. 'ubuntuone/password') as $1, or from the system keyring,
+where they can be saved with 'ghstat auth store'. Failing that, the following environment
+variables are used if they are set, and otherwise ghstat prompts for the credentials:
 
   - U1_LOGIN - the username/email for Ubuntu One login
   - U1_PASSWORD - the password for Ubuntu One login
+  - U1_TOTP_SECRET - the base32 TOTP seed for Ubuntu One, used to generate one-time passwords
+
+The TOTP seed can also be read from a file or the output of a command, such as a password
+manager, by setting 'greenhouse.login.totp.secretFile' or 'greenhouse.login.totp.secretCommand'.
+
+Cookies are saved in a file readable only by the current user. They can be encrypted with a key
+kept in the system keyring, or derived from a passphrase, by setting 'greenhouse.cookies.encryption'
+to 'keyring' or 'passphrase'. The passphrase is read from GHSTAT_COOKIE_PASSPHRASE, or prompted for.
+
+When logging in with a Greenhouse email address and password, by setting 'greenhouse.login.provider'
+to 'greenhouse' in the config file, GREENHOUSE_LOGIN and GREENHOUSE_PASSWORD can be set instead.
+
+Alternatively, ghstat can query the Greenhouse Harvest API directly by setting 'backend: harvest'
+in the config file, or by passing '--backend harvest'. The API key is read from the
+GREENHOUSE_API_KEY environment variable, or from 'harvest.apiKey' in the config file.
+
+ghstat launches a local Chrome or Chromium browser by default. To use an existing browser,
+such as one running in a container, set 'browser.url' in the config file or pass '--browser-url'
+with either the DevTools WebSocket URL or the address of the remote debugging port.
+
+When stdin is not a terminal, or '--non-interactive' is passed, ghstat never prompts. If a
+credential it needs is unavailable, or there is no valid session to reuse, it exits with code 3
+rather than 1, so that scheduled jobs can tell when somebody needs to log in with 'ghstat auth login'.
 
 For more information, visit the homepage at: https://github.com/jnsgruk/ghstat
 `
@@ -55,16 +103,234 @@ var rootCmd = &cobra.Command{
 	SilenceUsage:  true,
 
 	RunE: func(cmd *cobra.Command, args []string) error {
-		flags := cmd.PersistentFlags()
+		metric, _ := cmd.Flags().GetString("drill-down")
+		return run(cmd, runOptions{list: metric})
+	},
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show how role statistics have changed since a previous run",
+	Long: `Show how role statistics have changed since a previous run.
+
+The statistics for each role are gathered as usual, and compared with a run selected
+from the history store. By default, the most recent run is used. An earlier run can
+be selected with '--since', which accepts a duration such as '7d', '2w' or '36h', an
+RFC 3339 timestamp, or a date such as '2024-06-30'. The latest run at or before the
+specified time is used.
+
+Each value is shown alongside a marker indicating whether it has gone up or down.`,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, _ := cmd.Flags().GetString("since")
+		return run(cmd, runOptions{diff: true, since: since})
+	},
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the candidates behind a metric",
+	Long: `List the candidates behind a metric.
+
+Rather than counting the candidates matching a metric's query, the candidates are listed
+with their name, ID, current stage, last activity and a link to their profile in
+Greenhouse. By default, candidates are listed for every configured role. A single role,
+which need not be in the config file, can be selected with '--role'.
+
+The same listing is shown by passing '--drill-down <metric>' to ghstat itself.`,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		metric, _ := cmd.Flags().GetString("metric")
+		role, _ := cmd.Flags().GetInt64("role")
+		return run(cmd, runOptions{list: metric, listRole: role})
+	},
+}
+
+var debugCmd = &cobra.Command{
+	Use:   "debug",
+	Short: "Tools for diagnosing problems with ghstat",
+}
+
+var debugBundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Archive the latest debug bundle for a bug report",
+	Long: `Archive the latest debug bundle for a bug report.
+
+When run with '--debug-dir', ghstat saves its logs into a timestamped bundle in that
+directory, along with a screenshot, the HTML, the URL and the queries of any page which
+could not be scraped. This command zips the most recent bundle together with a copy of
+the config file, in which any API keys, passwords or other secrets are redacted.`,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		debugDir, _ := flags.GetString("debug-dir")
+		configFile, _ := flags.GetString("config")
+		outFile, _ := flags.GetString("file")
+
+		if len(debugDir) == 0 {
+			return errors.New("please specify the directory passed to '--debug-dir' when running ghstat")
+		}
+
+		dir, err := debug.Latest(debugDir)
+		if err != nil {
+			return err
+		}
+
+		configFile, err = ghstat.FindConfig(configFile)
+		if err != nil {
+			slog.Warn("bundle will not include a config file", "error", err.Error())
+		}
+
+		if len(outFile) == 0 {
+			outFile = fmt.Sprintf("ghstat-debug-%s.zip", filepath.Base(dir))
+		}
+
+		f, err := os.OpenFile(outFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create archive: %w", err)
+		}
+		defer f.Close()
+
+		err = debug.Archive(f, dir, configFile)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(outFile)
+		return nil
+	},
+}
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage the Greenhouse session and login credentials",
+}
+
+var authStoreCmd = &cobra.Command{
+	Use:   "store",
+	Short: "Save the credentials used to log in in the system keyring",
+	Long: `Save the credentials used to log in in the system keyring.
+
+ghstat prompts for each of the credentials used by the login provider, such as the login
+and password for Ubuntu One, and saves them in the Secret Service keyring (e.g. GNOME
+Keyring or KWallet) using 'secret-tool'. Credentials in the keyring are used in preference
+to environment variables and prompting, unless 'greenhouse.login.credentials.disableKeyring'
+is set in the config file. The login provider is read from the config file, unless it is
+specified with '--provider'.`,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		provider, _ := flags.GetString("provider")
+		configFile, _ := flags.GetString("config")
+
+		if len(provider) == 0 {
+			conf, err := ghstat.ParseConfig(configFile)
+			if err != nil {
+				return fmt.Errorf("failed to parse configuration: %w", err)
+			}
+			provider = conf.Greenhouse.Login.Provider
+		}
+
+		var prompter greenhouse.Prompter = greenhouse.TerminalPrompter{}
+		if nonInteractive(cmd) {
+			prompter = greenhouse.NonInteractivePrompter{}
+		}
+
+		err := ghstat.StoreCredentials(cmd.Context(), provider, prompter, credentials.Keyring{})
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("credentials saved in the system keyring")
+		return nil
+	},
+}
+
+var authLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in to Greenhouse and save the session",
+	Long: `Log in to Greenhouse and save the session.
+
+Only the login flow is run, without gathering any statistics. If the saved session is still
+valid, no login is required. Otherwise, ghstat logs in with the configured login provider and
+saves the session's cookies for future runs.`,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAuth(cmd, "login")
+	},
+}
+
+var authLogoutCmd = &cobra.Command{
+	Use:           "logout",
+	Short:         "Remove the saved Greenhouse session",
+	SilenceErrors: true,
+	SilenceUsage:  true,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAuth(cmd, "logout")
+	},
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Check whether the saved Greenhouse session is still valid",
+	Long: `Check whether the saved Greenhouse session is still valid.
+
+The host and account that the saved session belongs to are shown, along with when it was saved
+and when its cookies expire. Greenhouse is then opened with the session to check that it is
+still accepted. ghstat exits with an error if there is no saved session, or it is no longer
+valid. Pass '--output json' for machine-readable output.`,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runAuth(cmd, "status")
+	},
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve role statistics over HTTP, refreshing them periodically",
+	Long: `Serve role statistics over HTTP, refreshing them periodically.
+
+ghstat logs in to Greenhouse once, and keeps the same session and browser to refresh the
+statistics for every configured role on an interval. Between refreshes, requests are served
+from the results of the last successful refresh. The following endpoints are served:
+
+  - /                  an HTML dashboard showing the statistics for each lead
+  - /api/roles         the statistics for every role, as in '--output json'
+  - /api/leads/{name}  the statistics for the roles of a single lead
+  - /metrics           the statistics for every role, in the OpenMetrics format
+  - /healthz           reports that the server is running, and when it last refreshed
+  - /readyz            fails until the statistics have been gathered successfully
+
+The address and refresh interval default to 'serve.address' and 'serve.interval' in the
+config file, which default to 'localhost:8080' and '15m'.`,
+	SilenceErrors: true,
+	SilenceUsage:  true,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
 		verbose, _ := flags.GetBool("verbose")
-		output, _ := flags.GetString("output")
 		configFile, _ := flags.GetString("config")
 		leads, _ := flags.GetStringSlice("leads")
+		backend, _ := flags.GetString("backend")
+		browserURL, _ := flags.GetString("browser-url")
+		address, _ := flags.GetString("address")
+		interval, _ := flags.GetDuration("interval")
 
-		// Ensure the slog logger is set for the correct format/log level
-		setupLogging(verbose)
+		setupLogging(verbose, nil)
 
-		// Load and validate the configuration file
 		conf, err := ghstat.ParseConfig(configFile)
 		if err != nil {
 			return fmt.Errorf("failed to parse configuration: %w", err)
@@ -72,22 +338,256 @@ var rootCmd = &cobra.Command{
 
 		conf.Filter = leads
 		conf.Verbose = verbose
-		conf.Formatter = output
+		// Nobody is watching the terminal when the statistics are refreshed, so
+		// a refresh which needs credentials fails rather than waiting on a prompt
+		conf.NonInteractive = true
 
-		gh, err := greenhouse.NewGreenhouse()
-		if err != nil {
-			return fmt.Errorf("failed to create greenhouse client: %w", err)
+		if len(backend) > 0 {
+			conf.Backend = backend
+		}
+
+		if len(browserURL) > 0 {
+			conf.Browser.URL = browserURL
+		}
+
+		if len(address) > 0 {
+			conf.Serve.Address = address
+		}
+
+		if interval > 0 {
+			conf.Serve.Interval = interval
 		}
 
-		mgr, err := ghstat.NewManager(conf, gh, os.Stdout)
+		gh, err := ghstat.NewGreenhouseClient(conf)
 		if err != nil {
 			return err
 		}
-		return mgr.Execute()
+
+		// The client is closed once the server stops
+		return ghstat.Serve(cmd.Context(), conf, gh)
 	},
 }
 
-func setupLogging(verbose bool) {
+// runAuth loads the configuration and runs a session management command
+func runAuth(cmd *cobra.Command, action string) error {
+	flags := cmd.Flags()
+	verbose, _ := flags.GetBool("verbose")
+	output, _ := flags.GetString("output")
+	configFile, _ := flags.GetString("config")
+	backend, _ := flags.GetString("backend")
+	browserURL, _ := flags.GetString("browser-url")
+
+	setupLogging(verbose, nil)
+
+	conf, err := ghstat.ParseConfig(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to parse configuration: %w", err)
+	}
+
+	if len(backend) > 0 {
+		conf.Backend = backend
+	}
+
+	if len(browserURL) > 0 {
+		conf.Browser.URL = browserURL
+	}
+
+	conf.NonInteractive = nonInteractive(cmd)
+
+	switch action {
+	case "login":
+		err = ghstat.Login(cmd.Context(), conf)
+		if err != nil {
+			return err
+		}
+		fmt.Println("logged in to greenhouse")
+
+	case "logout":
+		err = ghstat.Logout(conf)
+		if err != nil {
+			return err
+		}
+		fmt.Println("removed saved greenhouse session")
+
+	case "status":
+		status, err := ghstat.Status(cmd.Context(), conf)
+		if err != nil {
+			return err
+		}
+
+		if output == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(status)
+		} else {
+			printSession(status)
+		}
+
+		if !status.Valid {
+			return fmt.Errorf("%w, the saved session is no longer valid", greenhouse.ErrNoSession)
+		}
+	}
+
+	return nil
+}
+
+// printSession outputs the status of a saved session for humans
+func printSession(status *greenhouse.Session) {
+	account := status.Account
+	if len(account) == 0 {
+		account = "unknown"
+	}
+
+	expires := "at the end of the browser session"
+	if !status.Expires.IsZero() {
+		expires = status.Expires.Local().Format(time.DateTime)
+	}
+
+	valid := "expired"
+	if status.Valid {
+		valid = "valid"
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Host:\t%s\n", status.Host)
+	fmt.Fprintf(w, "Account:\t%s\n", account)
+	if !status.Saved.IsZero() {
+		fmt.Fprintf(w, "Saved:\t%s\n", status.Saved.Local().Format(time.DateTime))
+	}
+	fmt.Fprintf(w, "Expires:\t%s\n", expires)
+	fmt.Fprintf(w, "Status:\t%s\n", valid)
+	w.Flush()
+}
+
+// runOptions control the output of a run of ghstat
+type runOptions struct {
+	diff     bool
+	since    string
+	list     string
+	listRole int64
+}
+
+// run gathers statistics for the configured roles and outputs them
+func run(cmd *cobra.Command, opts runOptions) error {
+	flags := cmd.Flags()
+	verbose, _ := flags.GetBool("verbose")
+	output, _ := flags.GetString("output")
+	templateFile, _ := flags.GetString("template")
+	noHeader, _ := flags.GetBool("no-header")
+	configFile, _ := flags.GetString("config")
+	leads, _ := flags.GetStringSlice("leads")
+	backend, _ := flags.GetString("backend")
+	recordDir, _ := flags.GetString("record")
+	replayDir, _ := flags.GetString("replay")
+	noHistory, _ := flags.GetBool("no-history")
+	strict, _ := flags.GetBool("strict")
+	browserURL, _ := flags.GetString("browser-url")
+	debugDir, _ := flags.GetString("debug-dir")
+
+	// Save the logs of the run into a new debug bundle if requested
+	var logFile io.Writer
+	var bundle *debug.Bundle
+	if len(debugDir) > 0 {
+		var err error
+		bundle, err = debug.NewBundle(debugDir, time.Now())
+		if err != nil {
+			return err
+		}
+
+		f, err := bundle.OpenLog()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		logFile = f
+	}
+
+	// Ensure the slog logger is set for the correct format/log level
+	setupLogging(verbose, logFile)
+	slog.Debug("starting ghstat", "version", version, "commit", commit, "command", cmd.CommandPath(), "flags", setFlags(cmd))
+
+	// Load and validate the configuration file
+	conf, err := ghstat.ParseConfig(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to parse configuration: %w", err)
+	}
+
+	// A template implies the template output format, unless another is chosen
+	if len(templateFile) > 0 && !flags.Changed("output") {
+		output = "template"
+	}
+
+	conf.Filter = leads
+	conf.Verbose = verbose
+	conf.Formatter = output
+	conf.Template = templateFile
+	conf.NoHeader = noHeader
+	conf.RecordDir = recordDir
+	conf.ReplayDir = replayDir
+	conf.Diff = opts.diff
+	conf.Since = opts.since
+	conf.List = opts.list
+	conf.ListRole = opts.listRole
+	conf.Strict = strict
+	conf.NonInteractive = nonInteractive(cmd)
+
+	if bundle != nil {
+		conf.DebugDir = bundle.Dir()
+	}
+
+	// Results gathered from recorded pages shouldn't pollute the history
+	if noHistory || len(replayDir) > 0 {
+		conf.History.Disabled = true
+	}
+
+	if len(backend) > 0 {
+		conf.Backend = backend
+	}
+
+	if len(browserURL) > 0 {
+		conf.Browser.URL = browserURL
+	}
+
+	gh, err := ghstat.NewGreenhouseClient(conf)
+	if err != nil {
+		return err
+	}
+
+	// Once constructed, the manager is responsible for closing the client
+	mgr, err := ghstat.NewManager(conf, gh, os.Stdout)
+	if err != nil {
+		gh.Close()
+		return err
+	}
+	return mgr.Execute(cmd.Context())
+}
+
+// nonInteractive reports whether ghstat should run without prompting or
+// animating its output, either because '--non-interactive' was passed, or
+// because stdin is not a terminal
+func nonInteractive(cmd *cobra.Command) bool {
+	if flag, _ := cmd.Flags().GetBool("non-interactive"); flag {
+		return true
+	}
+
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return true
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// setFlags returns the names of the flags set on the command line, without
+// their values, which may contain credentials
+func setFlags(cmd *cobra.Command) []string {
+	names := []string{}
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		names = append(names, f.Name)
+	})
+	return names
+}
+
+func setupLogging(verbose bool, logFile io.Writer) {
 	logLevel := new(slog.LevelVar)
 
 	// Set the default log level to "INFO", and "DEBUG" if verbose is specified.
@@ -97,7 +597,13 @@ func setupLogging(verbose bool) {
 	}
 
 	// Setup the TextHandler and ensure our configured logger is the default.
-	h := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+
+	// The log file always captures debug logs, regardless of verbosity
+	if logFile != nil {
+		h = debug.TeeHandler(h, slog.NewTextHandler(logFile, &slog.HandlerOptions{Level: slog.LevelDebug, ReplaceAttr: debug.RedactAttr}))
+	}
+
 	logger := slog.New(h)
 	slog.SetDefault(logger)
 	logLevel.Set(level)
@@ -106,15 +612,63 @@ func setupLogging(verbose bool) {
 func init() {
 	flags := rootCmd.PersistentFlags()
 	flags.BoolP("verbose", "v", false, "enable verbose logging")
-	flags.StringP("output", "o", "pretty", "choose the output format ('pretty', 'markdown' or 'json')")
+	flags.StringP("output", "o", "pretty", "choose the output format ('pretty', 'markdown', 'json', 'csv', 'tsv', 'html', 'openmetrics' or 'template')")
+	flags.String("template", "", "path to a Go template used to render 'template' output, with html/template for '.html' files")
+	flags.Bool("no-header", false, "omit the header row from 'csv' and 'tsv' output")
 	flags.StringP("config", "c", "", "path to a specific config file to use")
 	flags.StringSliceP("leads", "l", []string{}, "filter results to specific hiring leads from the config")
+	flags.StringP("backend", "b", "", "choose the backend used to query Greenhouse ('browser' or 'harvest')")
+	flags.String("browser-url", "", "connect to an existing browser's DevTools endpoint instead of launching one")
+	flags.String("record", "", "save the rendered HTML of each Greenhouse page fetched into a directory")
+	flags.String("replay", "", "serve Greenhouse pages from a directory created with --record, without logging in")
+	flags.Bool("no-history", false, "don't save the results of this run to the history store")
+	flags.Bool("strict", false, "exit with an error if any value could not be retrieved")
+	flags.String("debug-dir", "", "save logs, and screenshots and HTML of pages which fail to scrape, into a directory")
+	flags.Bool("non-interactive", false, "never prompt for credentials, and log progress instead of showing a spinner (default when stdin is not a terminal)")
+
+	diffCmd.Flags().String("since", "last", "the run to compare against ('last', a duration such as '7d', or a timestamp)")
+	rootCmd.AddCommand(diffCmd)
+
+	rootCmd.Flags().String("drill-down", "", "list the candidates behind the specified metric for each role, rather than counting them")
+
+	listCmd.Flags().String("metric", "", "the key of the metric to list candidates for")
+	listCmd.Flags().Int64("role", 0, "list candidates for a single role ID")
+	listCmd.MarkFlagRequired("metric")
+	rootCmd.AddCommand(listCmd)
+
+	debugBundleCmd.Flags().StringP("file", "f", "", "path of the zip archive to create (default \"ghstat-debug-<timestamp>.zip\")")
+	debugCmd.AddCommand(debugBundleCmd)
+	rootCmd.AddCommand(debugCmd)
+
+	serveCmd.Flags().String("address", "", "the address to listen on (default \"localhost:8080\")")
+	serveCmd.Flags().Duration("interval", 0, "how often the statistics are refreshed (default 15m)")
+	rootCmd.AddCommand(serveCmd)
+
+	authStoreCmd.Flags().String("provider", "", "the login provider to save credentials for ('ubuntuone' or 'greenhouse')")
+	authCmd.AddCommand(authLoginCmd, authLogoutCmd, authStatusCmd, authStoreCmd)
+	rootCmd.AddCommand(authCmd)
 }
 
+// exitAuthRequired is the exit code used when ghstat can't continue without
+// somebody logging in, so that wrappers can tell it apart from other failures
+const exitAuthRequired = 3
+
 func main() {
-	err := rootCmd.Execute()
+	// Cancel any in-flight work when interrupted or terminated
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	cmd, err := rootCmd.ExecuteContextC(ctx)
+	stop()
+
 	if err != nil {
 		slog.Error(err.Error())
+
+		// A missing session only needs somebody to log in when ghstat couldn't
+		// have prompted for credentials itself
+		var authErr *greenhouse.AuthRequiredError
+		if errors.As(err, &authErr) || (errors.Is(err, greenhouse.ErrNoSession) && cmd != nil && nonInteractive(cmd)) {
+			os.Exit(exitAuthRequired)
+		}
 		os.Exit(1)
 	}
 }